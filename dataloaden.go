@@ -1,28 +1,155 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
+	"runtime/debug"
 
 	"github.com/vektah/dataloaden/pkg/generator"
 )
 
+// exit codes, so scripts can tell what went wrong
+const (
+	exitBadInput = 1
+	exitResolve  = 2
+	exitWrite    = 3
+	exitStale    = 4
+)
+
 func main() {
-	if len(os.Args) != 4 {
-		fmt.Println("usage: name keyType valueType")
-		fmt.Println(" example:")
-		fmt.Println(" dataloaden 'UserLoader int []*github.com/my/package.User'")
-		os.Exit(1)
+	var opts generator.Options
+	config := flag.String("config", "", "generate every loader declared in a yaml config file")
+	output := flag.String("o", "", "file to write the loader to, defaults to the lowercase name with a _gen.go suffix")
+	pkg := flag.String("pkg", "", "package name of the generated file, defaults to the package in the output directory")
+	stdout := flag.Bool("stdout", false, "print the generated code instead of writing it")
+	dryRun := flag.Bool("dry-run", false, "generate everything but only print the files that would be written")
+	check := flag.Bool("check", false, "write nothing, but print a diff and fail if any file on disk is out of date")
+	showVersion := flag.Bool("version", false, "print the version of dataloaden and exit")
+	flag.BoolVar(&opts.Context, "context", false, "generate a Fetch that takes a context, along with LoadCtx and LoadThunkCtx")
+	flag.BoolVar(&opts.MapFetch, "map", false, "generate a Fetch that returns a map of results instead of a slice aligned with the keys")
+	flag.BoolVar(&opts.Cache, "cache", false, "let the Config take a dataloader.Cache instead of the built in unbounded map")
+	flag.BoolVar(&opts.Generic, "generic", false, "generate a thin wrapper over github.com/vektah/dataloaden/pkg/dataloader")
+	flag.BoolVar(&opts.Result, "result", false, "generate a Fetch and LoadAll that use a dataloader.Result per key instead of parallel slices")
+	flag.BoolVar(&opts.Middleware, "middleware", false, "generate context accessors and an http middleware that creates a loader per request")
+	flag.StringVar(&opts.CacheKey, "cache-key", "", "dedup and cache on this comparable type, derived from each key by Config.CacheKeyFn")
+	flag.Usage = usage
+	flag.Parse()
+
+	if *showVersion {
+		fmt.Println("dataloaden", version())
+		return
 	}
 
 	wd, err := os.Getwd()
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err.Error())
-		os.Exit(2)
+		exit(exitBadInput, err)
+	}
+
+	var loaders []generator.Loader
+	switch {
+	case *config != "" && opts != generator.Options{}:
+		exit(exitBadInput, fmt.Errorf("loader options can't be combined with -config, set them in %s instead", *config))
+
+	case *config != "" && flag.NArg() == 0 && *output == "" && *pkg == "":
+		cfg, err := generator.ReadConfig(*config)
+		if err != nil {
+			exit(exitBadInput, err)
+		}
+		wd = cfg.Dir
+		loaders = cfg.Loaders
+
+	case *config == "" && flag.NArg() == 3:
+		loaders = []generator.Loader{{
+			Name:      flag.Arg(0),
+			KeyType:   flag.Arg(1),
+			ValueType: flag.Arg(2),
+			Output:    *output,
+			Package:   *pkg,
+			Options:   opts,
+		}}
+
+	default:
+		flag.Usage()
+		os.Exit(exitBadInput)
+	}
+
+	for _, loader := range loaders {
+		if err := loader.Validate(); err != nil {
+			exit(exitBadInput, err)
+		}
+	}
+
+	files, err := generator.RenderLoaders(wd, loaders)
+	if err != nil {
+		exit(exitResolve, err)
+	}
+
+	stale := false
+	for _, f := range files {
+		switch {
+		case *check:
+			diff, err := f.Diff()
+			if err != nil {
+				exit(exitWrite, err)
+			}
+			if diff != "" {
+				fmt.Print(diff)
+				stale = true
+			}
+		case *stdout:
+			os.Stdout.Write(f.Src)
+		case *dryRun:
+			fmt.Println(f.Path)
+		default:
+			if err := f.Write(); err != nil {
+				exit(exitWrite, err)
+			}
+		}
 	}
 
-	if err := generator.Generate(os.Args[1], os.Args[2], os.Args[3], wd); err != nil {
-		fmt.Fprintln(os.Stderr, err.Error())
-		os.Exit(2)
+	if stale {
+		fmt.Fprintln(os.Stderr, "generated loaders are out of date, run dataloaden to regenerate them")
+		os.Exit(exitStale)
+	}
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintln(out, "usage: dataloaden [flags] name keyType valueType")
+	fmt.Fprintln(out, "       dataloaden [flags] -config dataloaden.yml")
+	fmt.Fprintln(out, " example:")
+	fmt.Fprintln(out, " dataloaden UserLoader int []*github.com/my/package.User")
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "flags:")
+	flag.PrintDefaults()
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "exit codes:")
+	fmt.Fprintln(out, "  1  bad arguments, config or type expressions")
+	fmt.Fprintln(out, "  2  unable to resolve the packages or types")
+	fmt.Fprintln(out, "  3  unable to read or write the output")
+	fmt.Fprintln(out, "  4  -check found generated files that are out of date")
+}
+
+func exit(code int, err error) {
+	fmt.Fprintln(os.Stderr, err.Error())
+	os.Exit(code)
+}
+
+// version reports the module version dataloaden was built from, whether it was installed directly or is being
+// run as a dependency of another module
+func version() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	if info.Main.Path == "github.com/vektah/dataloaden" {
+		return info.Main.Version
+	}
+	for _, dep := range info.Deps {
+		if dep.Path == "github.com/vektah/dataloaden" {
+			return dep.Version
+		}
 	}
+	return "unknown"
 }
@@ -66,3 +66,26 @@ func BenchmarkLoader(b *testing.B) {
 		wg.Wait()
 	})
 }
+
+func BenchmarkLoaderBatchSize(b *testing.B) {
+	for _, n := range []int{10, 1000, 100000} {
+		keys := make([]string, n)
+		for i := range keys {
+			keys[i] = strconv.Itoa(i)
+		}
+
+		b.Run(fmt.Sprintf("%d keys", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				// a fresh loader each time so nothing is cached, every key lands in one batch that is sent once full
+				dl := &UserLoader{
+					wait:     time.Second,
+					maxBatch: n,
+					fetch: func(keys []string) ([]*User, []error) {
+						return make([]*User, len(keys)), nil
+					},
+				}
+				dl.LoadAll(keys)
+			}
+		})
+	}
+}
@@ -0,0 +1,29 @@
+//go:generate go run github.com/vektah/dataloaden -cache UserLoader string *github.com/vektah/dataloaden/example.User
+
+package cache
+
+import (
+	"time"
+
+	"github.com/vektah/dataloaden/example"
+	"github.com/vektah/dataloaden/pkg/dataloader"
+)
+
+// NewLoader creates a loader that can outlive a single request, it only remembers the 1000 most recently used
+// users and will not return anything older than a minute.
+func NewLoader() *UserLoader {
+	return NewUserLoader(UserLoaderConfig{
+		Wait:     2 * time.Millisecond,
+		MaxBatch: 100,
+		Cache:    dataloader.NewLRUCache[string, *example.User](1000),
+		Fetch: func(keys []string) ([]*example.User, []error) {
+			users := make([]*example.User, len(keys))
+			errors := make([]error, len(keys))
+
+			for i, key := range keys {
+				users[i] = &example.User{ID: key, Name: "user " + key}
+			}
+			return users, errors
+		},
+	})
+}
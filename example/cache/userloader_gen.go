@@ -0,0 +1,605 @@
+// Code generated by github.com/vektah/dataloaden, DO NOT EDIT.
+
+package cache
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/vektah/dataloaden/pkg/dataloader"
+
+	"github.com/vektah/dataloaden/example"
+)
+
+// UserLoaderConfig captures the config to create a new UserLoader
+type UserLoaderConfig struct {
+	// Fetch is a method that provides the data for the loader
+	Fetch func(keys []string) ([]*example.User, []error)
+
+	// NotFound is an error Fetch returns for keys that don't exist, as well as dataloader.ErrNotFound. Keys that
+	// aren't found are cached, and LoadOptional reports them as missing instead of as an error.
+	NotFound error
+
+	// Wait is how long wait before sending a batch
+	Wait time.Duration
+
+	// MaxBatch will limit the maximum number of keys to send in one batch, 0 = not limit
+	MaxBatch int
+
+	// DispatchOnThunk sends a batch as soon as one of its thunks is called, instead of waiting for Wait to pass.
+	// Load calls its thunk straight away, so queue keys with LoadThunk or LoadAll to batch them.
+	DispatchOnThunk bool
+
+	// Scheduler sends batches when its Dispatch is called, instead of once Wait has passed. Loaders sharing a
+	// scheduler have their batches sent together.
+	Scheduler *dataloader.Scheduler
+
+	// Registry registers the loader under its name, and unless Scheduler is set sends its batches with the
+	// registry's scheduler.
+	Registry *dataloader.Registry
+
+	// Hooks are called as the loader works, to record metrics or trace batches
+	Hooks *dataloader.Hooks
+
+	// Logger logs batches slower than SlowBatchThreshold, and warns when batches keep being sent with a single key
+	Logger *slog.Logger
+
+	// SlowBatchThreshold is how long fetch can take before the batch is logged, 0 never logs slow batches
+	SlowBatchThreshold time.Duration
+
+	// PanicHandler is called with any panic recovered from Fetch, after every waiter has been given the error.
+	// It can be used to log the panic, or to re-panic and crash like an unrecovered panic would.
+	PanicHandler func(err *dataloader.PanicError)
+
+	// CacheErrors decides which errors returned by Fetch are cached and replayed to later loads of the same key.
+	// nil caches no errors, dataloader.CacheAllErrors caches every error.
+	// They are stored in Cache, and evicted like values.
+	CacheErrors func(err error) bool
+
+	// Cache stores fetched values, defaults to an unbounded dataloader.NewMapCache. Cached errors and keys that
+	// weren't found are only stored if it implements dataloader.ErrorCache.
+	Cache dataloader.Cache[string, *example.User]
+}
+
+// NewUserLoader creates a new UserLoader given a fetch, wait, and maxBatch
+func NewUserLoader(config UserLoaderConfig) *UserLoader {
+	l := &UserLoader{
+		fetch:              config.Fetch,
+		wait:               config.Wait,
+		maxBatch:           config.MaxBatch,
+		dispatchOnThunk:    config.DispatchOnThunk,
+		scheduler:          config.Scheduler,
+		hooks:              config.Hooks,
+		logger:             config.Logger,
+		slowBatchThreshold: config.SlowBatchThreshold,
+		panicHandler:       config.PanicHandler,
+		cacheErrors:        config.CacheErrors,
+		notFound:           config.NotFound,
+		cache:              config.Cache,
+	}
+	if config.Registry != nil {
+		if l.scheduler == nil {
+			l.scheduler = config.Registry.Scheduler()
+		}
+		config.Registry.Register("UserLoader", l)
+	}
+	return l
+}
+
+// UserLoader batches and caches requests
+type UserLoader struct {
+	// this method provides the data for the loader
+	fetch func(keys []string) ([]*example.User, []error)
+
+	// the error fetch returns for keys that don't exist
+	notFound error
+
+	// how long to done before sending a batch
+	wait time.Duration
+
+	// this will limit the maximum number of keys to send in one batch, 0 = no limit
+	maxBatch int
+
+	// send the batch as soon as one of its thunks is called
+	dispatchOnThunk bool
+
+	// sends batches in place of the timer, if set
+	scheduler *dataloader.Scheduler
+
+	// called as the loader works
+	hooks *dataloader.Hooks
+
+	// logs slow batches and loaders that aren't batching
+	logger *slog.Logger
+
+	// how long fetch can take before the batch is logged
+	slowBatchThreshold time.Duration
+
+	// called with any panic recovered from fetch
+	panicHandler func(err *dataloader.PanicError)
+
+	// decides which fetch errors are cached
+	cacheErrors func(err error) bool
+
+	// INTERNAL
+
+	// the cache, lazily created if one wasn't configured
+	cache dataloader.Cache[string, *example.User]
+
+	// counts the work done by the loader
+	stats dataloader.Stats
+
+	// how many batches in a row have been sent with a single key, only counted when there is a logger
+	singleKeyBatches int
+
+	// the current batch. keys will continue to be collected until timeout is hit,
+	// then everything will be sent to the fetch method and out to the listeners
+	batch *userLoaderBatch
+
+	// batches that have been started but haven't cached their results yet
+	inflight map[*userLoaderBatch]bool
+
+	// mutex to prevent races
+	mu sync.Mutex
+}
+
+type userLoaderBatch struct {
+	keys    []string
+	index   map[string]int
+	data    []*example.User
+	error   []error
+	closing bool
+	done    chan struct{}
+	timer   *time.Timer
+	start   time.Time
+
+	// keys set or cleared since the batch started, their fetched results are stale and aren't cached
+	written map[string]bool
+	cleared bool
+}
+
+// Load a User by key, batching and caching will be applied automatically
+func (l *UserLoader) Load(key string) (*example.User, error) {
+	return l.LoadThunk(key)()
+}
+
+// LoadOptional loads a User by key, returning false instead of an error if it doesn't exist
+func (l *UserLoader) LoadOptional(key string) (*example.User, bool, error) {
+	return l.optional(l.Load(key))
+}
+
+// optional turns not found errors into a missing value
+func (l *UserLoader) optional(value *example.User, err error) (*example.User, bool, error) {
+	if err == nil {
+		return value, true, nil
+	}
+
+	var zero *example.User
+	if dataloader.IsNotFound(err, l.notFound) {
+		return zero, false, nil
+	}
+	return zero, false, err
+}
+
+// LoadThunk returns a function that when called will block waiting for a User.
+// This method should be used if you want one goroutine to make requests to many
+// different data loaders without blocking until the thunk is called.
+func (l *UserLoader) LoadThunk(key string) func() (*example.User, error) {
+	l.hooks.Load("UserLoader")
+	l.mu.Lock()
+	l.stats.Loads++
+	if it, ok := l.unsafeGet(key); ok {
+		l.stats.Hits++
+		l.mu.Unlock()
+		l.hooks.CacheHit("UserLoader")
+		return func() (*example.User, error) {
+			return it, nil
+		}
+	}
+	if err, ok := dataloader.CacheGetError(l.cache, key); ok {
+		l.stats.Hits++
+		l.mu.Unlock()
+		l.hooks.CacheHit("UserLoader")
+		return func() (*example.User, error) {
+			var zero *example.User
+			return zero, err
+		}
+	}
+	if l.batch == nil {
+		l.batch = &userLoaderBatch{index: map[string]int{}, done: make(chan struct{})}
+		if l.inflight == nil {
+			l.inflight = map[*userLoaderBatch]bool{}
+		}
+		l.inflight[l.batch] = true
+	}
+	batch := l.batch
+	pos := batch.keyIndex(l, key)
+	l.mu.Unlock()
+
+	return func() (*example.User, error) {
+		if l.dispatchOnThunk {
+			l.mu.Lock()
+			batch.dispatch(l)
+			l.mu.Unlock()
+		}
+
+		<-batch.done
+
+		return batch.result(pos)
+	}
+}
+
+// LoadAll fetches many keys at once. It will be broken into appropriate sized
+// sub batches depending on how the loader is configured
+func (l *UserLoader) LoadAll(keys []string) ([]*example.User, []error) {
+	results := make([]func() (*example.User, error), len(keys))
+
+	for i, key := range keys {
+		results[i] = l.LoadThunk(key)
+	}
+
+	users := make([]*example.User, len(keys))
+	errors := make([]error, len(keys))
+	for i, thunk := range results {
+		users[i], errors[i] = thunk()
+	}
+	return users, errors
+}
+
+// LoadAllThunk returns a function that when called will block waiting for a Users.
+// This method should be used if you want one goroutine to make requests to many
+// different data loaders without blocking until the thunk is called.
+func (l *UserLoader) LoadAllThunk(keys []string) func() ([]*example.User, []error) {
+	results := make([]func() (*example.User, error), len(keys))
+	for i, key := range keys {
+		results[i] = l.LoadThunk(key)
+	}
+	return func() ([]*example.User, []error) {
+		users := make([]*example.User, len(keys))
+		errors := make([]error, len(keys))
+		for i, thunk := range results {
+			users[i], errors[i] = thunk()
+		}
+		return users, errors
+	}
+}
+
+// Prime the cache with the provided key and value. If the key already has a value, no change is made
+// and false is returned. Priming replaces any cached error for the key.
+// (To forcefully prime the cache, use Set.)
+func (l *UserLoader) Prime(key string, value *example.User) bool {
+	l.mu.Lock()
+	var found bool
+	if _, found = l.unsafeGet(key); !found {
+		l.unsafePrime(key, value)
+	}
+	l.mu.Unlock()
+	return !found
+}
+
+// PrimeMany primes the cache with every value whose key doesn't already have a value, returning how many were
+// primed
+func (l *UserLoader) PrimeMany(values map[string]*example.User) int {
+	primed := 0
+	l.mu.Lock()
+	for key, value := range values {
+		if _, found := l.unsafeGet(key); !found {
+			l.unsafePrime(key, value)
+			primed++
+		}
+	}
+	l.mu.Unlock()
+	return primed
+}
+
+// Set the value for key in the cache, replacing any value or error already cached for it
+func (l *UserLoader) Set(key string, value *example.User) {
+	l.mu.Lock()
+	l.unsafePrime(key, value)
+	l.mu.Unlock()
+}
+
+// SetMany sets every value in the cache at once, replacing any values or errors already cached for their keys
+func (l *UserLoader) SetMany(values map[string]*example.User) {
+	l.mu.Lock()
+	for key, value := range values {
+		l.unsafePrime(key, value)
+	}
+	l.mu.Unlock()
+}
+
+// Clear the value or error at key from the cache, if it exists
+func (l *UserLoader) Clear(key string) {
+	l.mu.Lock()
+	l.unsafeClear(key)
+	l.mu.Unlock()
+}
+
+// ClearMany clears the values and errors at every key from the cache at once
+func (l *UserLoader) ClearMany(keys []string) {
+	l.mu.Lock()
+	for _, key := range keys {
+		l.unsafeClear(key)
+	}
+	l.mu.Unlock()
+}
+
+// ClearAll clears every value and error from the cache, a cache shared with other loaders is cleared for all of them
+func (l *UserLoader) ClearAll() {
+	l.mu.Lock()
+	if l.cache != nil {
+		l.cache.Clear()
+	}
+	for b := range l.inflight {
+		b.cleared = true
+	}
+	l.mu.Unlock()
+}
+
+// Peek returns the cached User for key, without loading it if it isn't cached
+func (l *UserLoader) Peek(key string) (*example.User, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.unsafeGet(key)
+}
+
+// Has reports whether a User is cached for key
+func (l *UserLoader) Has(key string) bool {
+	_, ok := l.Peek(key)
+	return ok
+}
+
+// Len is the number of cached Users, caches that don't implement dataloader.Ranger are always empty
+func (l *UserLoader) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return dataloader.CacheLen(l.cache)
+}
+
+// Snapshot copies the cached Users, caches that don't implement dataloader.Ranger are always empty
+func (l *UserLoader) Snapshot() map[string]*example.User {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return dataloader.CacheSnapshot(l.cache)
+}
+
+// Flush sends the current batch straight away, instead of waiting for it to fill up or for wait to pass
+func (l *UserLoader) Flush() {
+	l.mu.Lock()
+	if l.batch != nil {
+		l.batch.dispatch(l)
+	}
+	l.mu.Unlock()
+}
+
+// logBatch logs batches slower than slowBatchThreshold, and warns when batches keep being sent with a single key
+func (l *UserLoader) logBatch(keys []string, duration time.Duration) {
+	if l.logger == nil {
+		return
+	}
+
+	if l.slowBatchThreshold > 0 && duration >= l.slowBatchThreshold {
+		l.logger.Warn("slow dataloader batch", "loader", "UserLoader", "keys", len(keys), "sample", dataloader.KeySample(keys), "duration", duration)
+	}
+
+	l.mu.Lock()
+	if len(keys) == 1 {
+		l.singleKeyBatches++
+	} else {
+		l.singleKeyBatches = 0
+	}
+	singleKeyBatches := l.singleKeyBatches
+	notBatching := singleKeyBatches > 0 && singleKeyBatches%dataloader.SingleKeyBatchWarning == 0
+	l.mu.Unlock()
+
+	if notBatching {
+		l.logger.Warn("dataloader is not batching", "loader", "UserLoader", "singleKeyBatches", singleKeyBatches, "wait", l.wait)
+	}
+}
+
+// Stats counts the keys loaded and fetched by the loader
+func (l *UserLoader) Stats() dataloader.Stats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.stats
+}
+
+func (l *UserLoader) unsafeGet(key string) (*example.User, bool) {
+	if l.cache == nil {
+		var zero *example.User
+		return zero, false
+	}
+	return l.cache.Get(key)
+}
+
+func (l *UserLoader) unsafeSet(key string, value *example.User) {
+	if l.cache == nil {
+		l.cache = dataloader.NewMapCache[string, *example.User]()
+	}
+	l.cache.Set(key, value)
+}
+
+// unsafePrime stores a copy of value, its easy to pass a pointer in from a loop var and end up with the whole
+// cache pointing to the same value.
+func (l *UserLoader) unsafePrime(key string, value *example.User) {
+	l.unsafeWritten(key)
+	cpy := *value
+	l.unsafeSet(key, &cpy)
+}
+
+func (l *UserLoader) unsafeClear(key string) {
+	l.unsafeWritten(key)
+	if l.cache != nil {
+		l.cache.Delete(key)
+	}
+}
+
+// unsafeWritten stops batches that are already in flight from caching a stale result over a write to key
+func (l *UserLoader) unsafeWritten(key string) {
+	for b := range l.inflight {
+		if b.written == nil {
+			b.written = map[string]bool{}
+		}
+		b.written[key] = true
+	}
+}
+
+func (l *UserLoader) unsafeSetError(key string, err error) {
+	if l.cache == nil {
+		l.cache = dataloader.NewMapCache[string, *example.User]()
+	}
+	dataloader.CacheSetError(l.cache, key, err)
+}
+
+// keyIndex will return the location of the key in the batch, if its not found
+// it will add the key to the batch
+func (b *userLoaderBatch) keyIndex(l *UserLoader, key string) int {
+	if i, ok := b.index[key]; ok {
+		return i
+	}
+
+	pos := len(b.keys)
+	b.keys = append(b.keys, key)
+	b.index[key] = pos
+	if pos == 0 {
+		b.startTimer(l)
+	}
+
+	if l.maxBatch != 0 && pos >= l.maxBatch-1 {
+		b.dispatch(l)
+	}
+
+	return pos
+}
+
+// startTimer schedules the batch to be sent once wait has passed, or by the scheduler if there is one.
+// The timer is stopped if the batch is closed early.
+func (b *userLoaderBatch) startTimer(l *UserLoader) {
+	b.start = time.Now()
+	if l.scheduler != nil {
+		l.scheduler.Schedule(func() {
+			l.mu.Lock()
+			b.dispatch(l)
+			l.mu.Unlock()
+		})
+		return
+	}
+
+	b.timer = time.AfterFunc(l.wait, func() {
+		b.timeout(l)
+	})
+}
+
+func (b *userLoaderBatch) timeout(l *UserLoader) {
+	l.mu.Lock()
+
+	// we must have hit a batch limit or been flushed and are already finalizing this batch
+	if b.closing {
+		l.mu.Unlock()
+		return
+	}
+
+	b.closing = true
+	l.batch = nil
+	l.mu.Unlock()
+
+	b.end(l)
+}
+
+// dispatch stops the batch collecting keys and sends it straight away, it must be called while holding the lock
+func (b *userLoaderBatch) dispatch(l *UserLoader) {
+	if b.closing {
+		return
+	}
+
+	b.closing = true
+	if b.timer != nil {
+		b.timer.Stop()
+	}
+	if l.batch == b {
+		l.batch = nil
+	}
+	go b.end(l)
+}
+
+func (b *userLoaderBatch) end(l *UserLoader) {
+	l.mu.Lock()
+	l.stats.Batches++
+	l.stats.Keys += len(b.keys)
+	l.mu.Unlock()
+
+	event := dataloader.BatchEvent{Loader: "UserLoader", Keys: len(b.keys), Wait: time.Since(b.start)}
+	ctx := l.hooks.BatchStart(context.Background(), event)
+	start := time.Now()
+
+	panicErr := b.fetch(l)
+	duration := time.Since(start)
+	l.hooks.BatchEnd(ctx, event, duration, b.error)
+	l.logBatch(b.keys, duration)
+	l.mu.Lock()
+	b.cache(l)
+	l.mu.Unlock()
+	close(b.done)
+
+	if panicErr != nil && l.panicHandler != nil {
+		l.panicHandler(panicErr)
+	}
+}
+
+// cache stores the results of the batch. Keys written since the
+// batch started keep what was written.
+func (b *userLoaderBatch) cache(l *UserLoader) {
+	delete(l.inflight, b)
+	if b.cleared {
+		return
+	}
+
+	for pos, key := range b.keys {
+		if b.written[key] {
+			continue
+		}
+		data, err := b.result(pos)
+		if err == nil {
+			l.unsafeSet(key, data)
+		} else if dataloader.IsNotFound(err, l.notFound) || (l.cacheErrors != nil && l.cacheErrors(err)) {
+			l.unsafeSetError(key, err)
+		}
+	}
+}
+
+// result is the User and error fetched for the key at pos
+func (b *userLoaderBatch) result(pos int) (*example.User, error) {
+	var data *example.User
+	if pos < len(b.data) {
+		data = b.data[pos]
+	}
+
+	var err error
+	// its convenient to be able to return a single error for everything
+	if len(b.error) == 1 {
+		err = b.error[0]
+	} else if len(b.error) > 0 {
+		err = b.error[pos]
+	}
+	return data, err
+}
+
+// fetch calls the fetch func for the batch, any panic is recovered and returned to every waiter
+func (b *userLoaderBatch) fetch(l *UserLoader) (panicErr *dataloader.PanicError) {
+	defer func() {
+		if r := recover(); r != nil {
+			panicErr = dataloader.NewPanicError("UserLoader", r)
+			b.data = nil
+			b.error = []error{panicErr}
+		}
+	}()
+
+	b.data, b.error = l.fetch(b.keys)
+	if err := dataloader.CheckBatchLength("UserLoader", len(b.keys), len(b.data), b.error); err != nil {
+		b.data = nil
+		b.error = []error{err}
+	}
+	return nil
+}
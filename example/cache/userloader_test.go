@@ -0,0 +1,117 @@
+package cache
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vektah/dataloaden/example"
+	"github.com/vektah/dataloaden/pkg/dataloader"
+)
+
+func TestUserLoader(t *testing.T) {
+	var fetches [][]string
+	var mu sync.Mutex
+
+	dl := NewUserLoader(UserLoaderConfig{
+		Wait:     time.Millisecond,
+		MaxBatch: 5,
+		Cache:    dataloader.NewLRUCache[string, *example.User](2),
+		Fetch: func(keys []string) ([]*example.User, []error) {
+			mu.Lock()
+			fetches = append(fetches, keys)
+			mu.Unlock()
+
+			users := make([]*example.User, len(keys))
+			for i, key := range keys {
+				users[i] = &example.User{ID: key, Name: "user " + key}
+			}
+			return users, nil
+		},
+	})
+
+	t.Run("values are read from the configured cache", func(t *testing.T) {
+		_, errs := dl.LoadAll([]string{"U1", "U2"})
+		require.NoError(t, errs[0])
+		require.NoError(t, errs[1])
+
+		u, err := dl.Load("U1")
+		require.NoError(t, err)
+		require.Equal(t, "user U1", u.Name)
+		require.Len(t, fetches, 1)
+	})
+
+	t.Run("evicted values go back to the fetcher", func(t *testing.T) {
+		_, err := dl.Load("U3")
+		require.NoError(t, err)
+		require.Len(t, fetches, 2)
+
+		// U2 was the least recently used
+		require.False(t, dl.Has("U2"))
+		u, err := dl.Load("U2")
+		require.NoError(t, err)
+		require.Equal(t, "user U2", u.Name)
+		require.Len(t, fetches, 3)
+
+		require.Equal(t, 2, dl.Len())
+		require.Equal(t, map[string]*example.User{"U2": u, "U3": {ID: "U3", Name: "user U3"}}, dl.Snapshot())
+	})
+
+	t.Run("primed values are stored in the configured cache", func(t *testing.T) {
+		dl.Prime("U99", &example.User{ID: "U99", Name: "Primed user"})
+		u, err := dl.Load("U99")
+		require.NoError(t, err)
+		require.Equal(t, "Primed user", u.Name)
+		require.Len(t, fetches, 3)
+
+		dl.Clear("U99")
+		u, err = dl.Load("U99")
+		require.NoError(t, err)
+		require.Equal(t, "user U99", u.Name)
+		require.Len(t, fetches, 4)
+	})
+}
+
+func TestUserLoaderCachedErrors(t *testing.T) {
+	var fetches int
+	var mu sync.Mutex
+	cache := dataloader.NewLRUCache[string, *example.User](2)
+	config := UserLoaderConfig{
+		Wait:        time.Millisecond,
+		Cache:       cache,
+		CacheErrors: dataloader.CacheAllErrors,
+		Fetch: func(keys []string) ([]*example.User, []error) {
+			mu.Lock()
+			fetches++
+			mu.Unlock()
+			return nil, []error{dataloader.ErrNotFound}
+		},
+	}
+	dl := NewUserLoader(config)
+	other := NewUserLoader(config)
+
+	t.Run("errors are stored in the configured cache", func(t *testing.T) {
+		_, err := dl.Load("U1")
+		require.ErrorIs(t, err, dataloader.ErrNotFound)
+		_, err = other.Load("U1")
+		require.ErrorIs(t, err, dataloader.ErrNotFound)
+		require.Equal(t, 1, fetches)
+		require.Equal(t, 0, dl.Len())
+	})
+
+	t.Run("errors are evicted like values", func(t *testing.T) {
+		dl.Prime("U2", &example.User{ID: "U2"})
+		dl.Prime("U3", &example.User{ID: "U3"})
+		_, err := dl.Load("U1")
+		require.ErrorIs(t, err, dataloader.ErrNotFound)
+		require.Equal(t, 2, fetches)
+	})
+
+	t.Run("clearing a shared cache clears errors for every loader", func(t *testing.T) {
+		other.ClearAll()
+		_, err := dl.Load("U1")
+		require.ErrorIs(t, err, dataloader.ErrNotFound)
+		require.Equal(t, 3, fetches)
+	})
+}
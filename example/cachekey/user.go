@@ -0,0 +1,39 @@
+//go:generate go run github.com/vektah/dataloaden -cache-key string UserLoader UserQuery *github.com/vektah/dataloaden/example.User
+
+package cachekey
+
+import (
+	"strings"
+	"time"
+
+	"github.com/vektah/dataloaden/example"
+)
+
+// UserQuery looks a user up within a tenant. It holds a slice so it isn't comparable, the loader dedups and caches
+// on its CacheKey instead.
+type UserQuery struct {
+	Tenant string
+	ID     string
+	Fields []string
+}
+
+// CacheKey identifies the user being queried, queries for the same user with different fields share a result
+func (q UserQuery) CacheKey() string {
+	return q.Tenant + "/" + q.ID
+}
+
+// NewLoader creates a loader that is keyed by UserQuery
+func NewLoader() *UserLoader {
+	return NewUserLoader(UserLoaderConfig{
+		Wait:       2 * time.Millisecond,
+		MaxBatch:   100,
+		CacheKeyFn: UserQuery.CacheKey,
+		Fetch: func(keys []UserQuery) ([]*example.User, []error) {
+			users := make([]*example.User, len(keys))
+			for i, key := range keys {
+				users[i] = &example.User{ID: key.ID, Name: key.Tenant + " user " + key.ID + " " + strings.Join(key.Fields, ",")}
+			}
+			return users, nil
+		},
+	})
+}
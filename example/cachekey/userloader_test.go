@@ -0,0 +1,94 @@
+package cachekey
+
+import (
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vektah/dataloaden/example"
+)
+
+func TestUserLoader(t *testing.T) {
+	var fetches [][]UserQuery
+	var mu sync.Mutex
+
+	dl := NewUserLoader(UserLoaderConfig{
+		Wait:       10 * time.Millisecond,
+		CacheKeyFn: UserQuery.CacheKey,
+		Fetch: func(keys []UserQuery) ([]*example.User, []error) {
+			mu.Lock()
+			fetches = append(fetches, keys)
+			mu.Unlock()
+
+			users := make([]*example.User, len(keys))
+			for i, key := range keys {
+				users[i] = &example.User{ID: key.ID, Name: key.Tenant + " user " + key.ID}
+			}
+			return users, nil
+		},
+	})
+
+	t.Run("keys with the same cache key are fetched once", func(t *testing.T) {
+		users, errs := dl.LoadAll([]UserQuery{
+			{Tenant: "T1", ID: "U1", Fields: []string{"name"}},
+			{Tenant: "T1", ID: "U1", Fields: []string{"email"}},
+			{Tenant: "T2", ID: "U1"},
+		})
+		require.Equal(t, []error{nil, nil, nil}, errs)
+		require.Equal(t, "T1 user U1", users[0].Name)
+		require.Equal(t, users[0], users[1])
+		require.Equal(t, "T2 user U1", users[2].Name)
+
+		require.Len(t, fetches, 1)
+		require.Equal(t, []UserQuery{
+			{Tenant: "T1", ID: "U1", Fields: []string{"name"}},
+			{Tenant: "T2", ID: "U1"},
+		}, fetches[0], "the original keys are passed to fetch")
+	})
+
+	t.Run("values are cached by cache key", func(t *testing.T) {
+		u, err := dl.Load(UserQuery{Tenant: "T1", ID: "U1", Fields: []string{"id"}})
+		require.NoError(t, err)
+		require.Equal(t, "T1 user U1", u.Name)
+		require.Len(t, fetches, 1)
+
+		require.True(t, dl.Has(UserQuery{Tenant: "T2", ID: "U1", Fields: []string{"id"}}))
+		require.Equal(t, []string{"T1/U1", "T2/U1"}, sortedKeys(dl.Snapshot()))
+	})
+
+	t.Run("priming and clearing use the cache key", func(t *testing.T) {
+		dl.Clear(UserQuery{Tenant: "T1", ID: "U1"})
+		require.True(t, dl.Prime(UserQuery{Tenant: "T1", ID: "U1"}, &example.User{ID: "U1", Name: "Primed user"}))
+
+		u, err := dl.Load(UserQuery{Tenant: "T1", ID: "U1", Fields: []string{"name"}})
+		require.NoError(t, err)
+		require.Equal(t, "Primed user", u.Name)
+		require.Len(t, fetches, 1)
+	})
+
+	t.Run("bulk updates use the cache key", func(t *testing.T) {
+		require.Equal(t, 1, dl.PrimeMany(map[string]*example.User{
+			"T1/U1": {ID: "U1", Name: "ignored"},
+			"T3/U1": {ID: "U1", Name: "Primed user"},
+		}))
+		dl.ClearMany([]UserQuery{{Tenant: "T1", ID: "U1", Fields: []string{"name"}}, {Tenant: "T2", ID: "U1"}})
+		require.Equal(t, []string{"T3/U1"}, sortedKeys(dl.Snapshot()))
+	})
+}
+
+func sortedKeys(snapshot map[string]*example.User) []string {
+	keys := make([]string, 0, len(snapshot))
+	for key := range snapshot {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestUserLoaderRequiresCacheKeyFn(t *testing.T) {
+	require.PanicsWithValue(t, "UserLoader: CacheKeyFn is required", func() {
+		NewUserLoader(UserLoaderConfig{})
+	})
+}
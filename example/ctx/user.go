@@ -0,0 +1,28 @@
+//go:generate go run github.com/vektah/dataloaden -context UserLoader string *github.com/vektah/dataloaden/example.User
+
+package ctx
+
+import (
+	"context"
+	"time"
+
+	"github.com/vektah/dataloaden/example"
+)
+
+// NewLoader will collect user requests for 2 milliseconds and send them as a single batch to the fetch func,
+// the fetch func receives the batch context so deadlines and tracing reach the database.
+func NewLoader() *UserLoader {
+	return &UserLoader{
+		wait:     2 * time.Millisecond,
+		maxBatch: 100,
+		fetch: func(ctx context.Context, keys []string) ([]*example.User, []error) {
+			users := make([]*example.User, len(keys))
+			errors := make([]error, len(keys))
+
+			for i, key := range keys {
+				users[i] = &example.User{ID: key, Name: "user " + key}
+			}
+			return users, errors
+		},
+	}
+}
@@ -0,0 +1,111 @@
+package ctx
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vektah/dataloaden/example"
+)
+
+type ctxKey string
+
+func TestUserLoader(t *testing.T) {
+	var fetches [][]string
+	var mu sync.Mutex
+	release := make(chan struct{})
+
+	dl := &UserLoader{
+		wait:     10 * time.Millisecond,
+		maxBatch: 5,
+		fetch: func(ctx context.Context, keys []string) ([]*example.User, []error) {
+			mu.Lock()
+			fetches = append(fetches, keys)
+			mu.Unlock()
+
+			if strings.HasPrefix(keys[0], "slow") {
+				select {
+				case <-release:
+				case <-ctx.Done():
+					return nil, []error{ctx.Err()}
+				}
+			}
+
+			users := make([]*example.User, len(keys))
+			for i, key := range keys {
+				users[i] = &example.User{ID: key, Name: ctx.Value(ctxKey("name")).(string) + " " + key}
+			}
+			return users, nil
+		},
+	}
+
+	t.Run("values from the first caller are passed to fetch", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.WithValue(context.Background(), ctxKey("name"), "user"))
+		u, err := dl.LoadCtx(ctx, "U1")
+		cancel()
+		require.NoError(t, err)
+		require.Equal(t, "user U1", u.Name)
+	})
+
+	t.Run("cancelled waiters return right away", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.WithValue(context.Background(), ctxKey("name"), "user"))
+		thunk := dl.LoadThunkCtx(ctx, "slow")
+		u2 := dl.LoadThunkCtx(context.WithValue(context.Background(), ctxKey("name"), "other"), "U2")
+		cancel()
+
+		u, err := thunk()
+		require.Equal(t, context.Canceled, err)
+		require.Nil(t, u)
+
+		// the batch is still wanted by U2 so it must not be cancelled
+		close(release)
+		user2, err := u2()
+		require.NoError(t, err)
+		require.Equal(t, "user U2", user2.Name, "fetch should see the values of the first caller")
+	})
+
+	t.Run("batches are dropped once every waiter gives up", func(t *testing.T) {
+		mu.Lock()
+		before := len(fetches)
+		mu.Unlock()
+
+		ctx, cancel := context.WithCancel(context.WithValue(context.Background(), ctxKey("name"), "user"))
+		thunk := dl.LoadAllThunkCtx(ctx, []string{"U3", "U4"})
+		cancel()
+
+		_, errs := thunk()
+		require.Equal(t, context.Canceled, errs[0])
+		require.Equal(t, context.Canceled, errs[1])
+
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		require.Len(t, fetches, before)
+		mu.Unlock()
+
+		u, err := dl.LoadCtx(context.WithValue(context.Background(), ctxKey("name"), "user"), "U3")
+		require.NoError(t, err)
+		require.Equal(t, "user U3", u.Name)
+	})
+
+	t.Run("a fetch in flight is cancelled when every waiter gives up", func(t *testing.T) {
+		release = make(chan struct{})
+		ctx, cancel := context.WithCancel(context.WithValue(context.Background(), ctxKey("name"), "user"))
+		// slow was fetched for U2 above, so it is cached
+		thunk := dl.LoadThunkCtx(ctx, "slower")
+
+		// wait for the batch to be dispatched
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+
+		_, err := thunk()
+		require.Equal(t, context.Canceled, err)
+
+		close(release)
+		u, err := dl.LoadCtx(context.WithValue(context.Background(), ctxKey("name"), "user"), "slower")
+		require.NoError(t, err)
+		require.Equal(t, "user slower", u.Name, "results of a cancelled fetch aren't cached")
+	})
+}
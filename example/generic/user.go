@@ -0,0 +1,27 @@
+//go:generate go run github.com/vektah/dataloaden -generic UserLoader string *github.com/vektah/dataloaden/example.User
+
+package generic
+
+import (
+	"time"
+
+	"github.com/vektah/dataloaden/example"
+)
+
+// NewLoader will collect user requests for 2 milliseconds and send them as a single batch to the fetch func
+// normally fetch would be a database call.
+func NewLoader() *UserLoader {
+	return NewUserLoader(UserLoaderConfig{
+		Wait:     2 * time.Millisecond,
+		MaxBatch: 100,
+		Fetch: func(keys []string) ([]*example.User, []error) {
+			users := make([]*example.User, len(keys))
+			errors := make([]error, len(keys))
+
+			for i, key := range keys {
+				users[i] = &example.User{ID: key, Name: "user " + key}
+			}
+			return users, errors
+		},
+	})
+}
@@ -0,0 +1,23 @@
+// Code generated by github.com/vektah/dataloaden, DO NOT EDIT.
+
+package generic
+
+import (
+	"github.com/vektah/dataloaden/pkg/dataloader"
+
+	"github.com/vektah/dataloaden/example"
+)
+
+// UserLoaderConfig captures the config to create a new UserLoader
+type UserLoaderConfig = dataloader.Config[string, *example.User]
+
+// UserLoader batches and caches requests
+type UserLoader = dataloader.Loader[string, *example.User]
+
+// NewUserLoader creates a new UserLoader given a fetch, wait, and maxBatch
+func NewUserLoader(config UserLoaderConfig) *UserLoader {
+	if config.Name == "" {
+		config.Name = "UserLoader"
+	}
+	return dataloader.New(config)
+}
@@ -0,0 +1,112 @@
+package generic
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vektah/dataloaden/example"
+	"github.com/vektah/dataloaden/pkg/dataloader"
+)
+
+func TestUserLoader(t *testing.T) {
+	var fetches [][]string
+	var mu sync.Mutex
+	scheduler := dataloader.NewScheduler()
+
+	dl := NewUserLoader(UserLoaderConfig{
+		Scheduler: scheduler,
+		MaxBatch:  5,
+		Fetch: func(keys []string) ([]*example.User, []error) {
+			mu.Lock()
+			fetches = append(fetches, keys)
+			mu.Unlock()
+
+			users := make([]*example.User, len(keys))
+			errors := make([]error, len(keys))
+
+			for i, key := range keys {
+				if strings.HasPrefix(key, "E") {
+					errors[i] = fmt.Errorf("user not found")
+				} else {
+					users[i] = &example.User{ID: key, Name: "user " + key}
+				}
+			}
+			return users, errors
+		},
+	})
+
+	t.Run("keys are batched until the scheduler dispatches", func(t *testing.T) {
+		thunk1 := dl.LoadThunk("U1")
+		thunk2 := dl.LoadAllThunk([]string{"U2", "E2", "E3", "U4"})
+		thunk3 := dl.LoadAllThunk([]string{"U5", "U6"})
+		scheduler.Dispatch()
+
+		u, err := thunk1()
+		require.NoError(t, err)
+		require.Equal(t, "U1", u.ID)
+
+		users, errs := thunk2()
+		require.Equal(t, "user U2", users[0].Name)
+		require.Error(t, errs[1])
+		require.Error(t, errs[2])
+		require.Equal(t, "user U4", users[3].Name)
+
+		users, errs = thunk3()
+		require.Equal(t, []error{nil, nil}, errs)
+		require.Equal(t, "user U6", users[1].Name)
+
+		// the full batch was sent straight away, so the batches may have been fetched in either order
+		require.ElementsMatch(t, [][]string{{"U1", "U2", "E2", "E3", "U4"}, {"U5", "U6"}}, fetches)
+	})
+
+	t.Run("values are cached and errors are not", func(t *testing.T) {
+		thunk := dl.LoadAllThunk([]string{"U1", "U4", "E1", "U9"})
+		scheduler.Dispatch()
+		users, errs := thunk()
+		require.Equal(t, "U1", users[0].ID)
+		require.Equal(t, "U4", users[1].ID)
+		require.Error(t, errs[2])
+		require.Equal(t, "U9", users[3].ID)
+
+		require.Len(t, fetches, 3)
+		require.Equal(t, []string{"E1", "U9"}, fetches[2])
+	})
+
+	t.Run("primed values are copied and cleared values are fetched again", func(t *testing.T) {
+		users := []example.User{
+			{ID: "Alpha", Name: "Alpha"},
+			{ID: "Omega", Name: "Omega"},
+		}
+		for _, user := range users {
+			dl.Prime(user.ID, &user)
+		}
+
+		u, err := dl.Load("Alpha")
+		require.NoError(t, err)
+		require.Equal(t, "Alpha", u.Name)
+		require.Len(t, fetches, 3)
+
+		dl.Clear("Alpha")
+		thunk := dl.LoadThunk("Alpha")
+		scheduler.Dispatch()
+		u, err = thunk()
+		require.NoError(t, err)
+		require.Equal(t, "user Alpha", u.Name)
+		require.Len(t, fetches, 4)
+	})
+}
+
+func TestUserLoaderName(t *testing.T) {
+	var loaders []string
+	hooks := &dataloader.Hooks{OnLoad: func(loader string) { loaders = append(loaders, loader) }}
+	fetch := func(keys []string) ([]*example.User, []error) {
+		return make([]*example.User, len(keys)), nil
+	}
+
+	NewUserLoader(UserLoaderConfig{Hooks: hooks, Fetch: fetch}).Load("U1")
+	NewUserLoader(UserLoaderConfig{Name: "AdminLoader", Hooks: hooks, Fetch: fetch}).Load("U1")
+	require.Equal(t, []string{"UserLoader", "AdminLoader"}, loaders, "loaders are named after their type unless configured")
+}
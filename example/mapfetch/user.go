@@ -0,0 +1,33 @@
+//go:generate go run github.com/vektah/dataloaden -map UserLoader string *github.com/vektah/dataloaden/example.User
+
+package mapfetch
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/vektah/dataloaden/example"
+)
+
+// ErrUserNotFound is returned for users missing from the database
+var ErrUserNotFound = errors.New("user not found")
+
+// NewLoader will collect user requests for 2 milliseconds and send them as a single batch to the fetch func.
+// Like most `WHERE id IN (...)` queries the results come back in any order and skip missing users.
+func NewLoader() *UserLoader {
+	return NewUserLoader(UserLoaderConfig{
+		Wait:     2 * time.Millisecond,
+		MaxBatch: 100,
+		NotFound: ErrUserNotFound,
+		Fetch: func(keys []string) (map[string]*example.User, error) {
+			users := map[string]*example.User{}
+			for _, key := range keys {
+				if !strings.HasPrefix(key, "E") {
+					users[key] = &example.User{ID: key, Name: "user " + key}
+				}
+			}
+			return users, nil
+		},
+	})
+}
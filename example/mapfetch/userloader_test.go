@@ -0,0 +1,92 @@
+package mapfetch
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vektah/dataloaden/example"
+	"github.com/vektah/dataloaden/pkg/dataloader"
+)
+
+func TestUserLoader(t *testing.T) {
+	var fetches [][]string
+	var mu sync.Mutex
+	fetchErr := errors.New("database is down")
+
+	dl := NewUserLoader(UserLoaderConfig{
+		Wait:     10 * time.Millisecond,
+		MaxBatch: 5,
+		NotFound: ErrUserNotFound,
+		Fetch: func(keys []string) (map[string]*example.User, error) {
+			mu.Lock()
+			fetches = append(fetches, keys)
+			mu.Unlock()
+
+			users := map[string]*example.User{}
+			// walk the keys backwards so results are never in key order
+			for i := len(keys) - 1; i >= 0; i-- {
+				switch keys[i][0] {
+				case 'E':
+				case 'F':
+					return nil, fetchErr
+				default:
+					users[keys[i]] = &example.User{ID: keys[i], Name: "user " + keys[i]}
+				}
+			}
+			return users, nil
+		},
+	})
+
+	t.Run("results are lined up with the keys", func(t *testing.T) {
+		u, err := dl.LoadAll([]string{"U1", "E1", "U2"})
+		require.NoError(t, err[0])
+		require.Equal(t, "user U1", u[0].Name)
+		require.Equal(t, ErrUserNotFound, err[1])
+		require.Nil(t, u[1])
+		require.NoError(t, err[2])
+		require.Equal(t, "user U2", u[2].Name)
+	})
+
+	t.Run("fetch errors are returned for every key", func(t *testing.T) {
+		_, err := dl.LoadAll([]string{"U3", "F1"})
+		require.Equal(t, fetchErr, err[0])
+		require.Equal(t, fetchErr, err[1])
+	})
+
+	t.Run("missing keys default to dataloader.ErrNotFound", func(t *testing.T) {
+		dl := NewUserLoader(UserLoaderConfig{
+			Fetch: func(keys []string) (map[string]*example.User, error) {
+				return nil, nil
+			},
+		})
+
+		u, err := dl.Load("E1")
+		require.Equal(t, dataloader.ErrNotFound, err)
+		require.Nil(t, u)
+
+		_, ok, err := dl.LoadOptional("E1")
+		require.NoError(t, err)
+		require.False(t, ok)
+	})
+
+	t.Run("missing keys are optional", func(t *testing.T) {
+		u, ok, err := dl.LoadOptional("E2")
+		require.NoError(t, err)
+		require.False(t, ok)
+		require.Nil(t, u)
+
+		u, ok, err = dl.LoadOptional("U1")
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Equal(t, "user U1", u.Name)
+	})
+
+	t.Run("found users are cached", func(t *testing.T) {
+		_, err := dl.Load("U1")
+		require.NoError(t, err)
+		require.Len(t, fetches, 3)
+	})
+}
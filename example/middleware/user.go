@@ -0,0 +1,27 @@
+//go:generate go run github.com/vektah/dataloaden -middleware UserLoader string *github.com/vektah/dataloaden/example.User
+
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/vektah/dataloaden/example"
+)
+
+// Loaders installs a new UserLoader in the context of every request, handlers get it back with UserLoaderFrom
+func Loaders(next http.Handler) http.Handler {
+	return UserLoaderMiddleware(func(r *http.Request) UserLoaderConfig {
+		return UserLoaderConfig{
+			Wait:     2 * time.Millisecond,
+			MaxBatch: 100,
+			Fetch: func(keys []string) ([]*example.User, []error) {
+				users := make([]*example.User, len(keys))
+				for i, key := range keys {
+					users[i] = &example.User{ID: key, Name: "user " + key}
+				}
+				return users, nil
+			},
+		}
+	})(next)
+}
@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserLoaderMiddleware(t *testing.T) {
+	var loaders []*UserLoader
+	handler := Loaders(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		dl := UserLoaderFrom(r.Context())
+		require.NotNil(t, dl)
+		loaders = append(loaders, dl)
+
+		u, err := dl.Load(r.URL.Query().Get("id"))
+		require.NoError(t, err)
+		w.Write([]byte(u.Name))
+	}))
+
+	for _, id := range []string{"U1", "U2"} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/?id="+id, nil))
+		require.Equal(t, "user "+id, w.Body.String())
+	}
+
+	require.Len(t, loaders, 2)
+	require.NotSame(t, loaders[0], loaders[1], "every request gets its own loader")
+}
+
+func TestUserLoaderFrom(t *testing.T) {
+	require.Nil(t, UserLoaderFrom(context.Background()))
+
+	ctx := WithUserLoader(context.Background(), UserLoaderConfig{})
+	require.NotNil(t, UserLoaderFrom(ctx))
+}
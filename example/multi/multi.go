@@ -0,0 +1,4 @@
+//go:generate go run github.com/vektah/dataloaden -config dataloaden.yml
+
+// Package multi generates several loaders from a single config file
+package multi
@@ -0,0 +1,667 @@
+// Code generated by github.com/vektah/dataloaden, DO NOT EDIT.
+
+package multi
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/vektah/dataloaden/pkg/dataloader"
+
+	"github.com/vektah/dataloaden/example"
+)
+
+// UserSliceLoaderConfig captures the config to create a new UserSliceLoader
+type UserSliceLoaderConfig struct {
+	// Fetch is a method that provides the data for the loader
+	// ctx is the batch context, it carries the values of the first caller in the batch and is only cancelled
+	// once every caller waiting on the batch has given up
+	Fetch func(ctx context.Context, keys []int) ([][]example.User, []error)
+
+	// NotFound is an error Fetch returns for keys that don't exist, as well as dataloader.ErrNotFound. Keys that
+	// aren't found are cached, and LoadOptional reports them as missing instead of as an error.
+	NotFound error
+
+	// Wait is how long wait before sending a batch
+	Wait time.Duration
+
+	// MaxBatch will limit the maximum number of keys to send in one batch, 0 = not limit
+	MaxBatch int
+
+	// DispatchOnThunk sends a batch as soon as one of its thunks is called, instead of waiting for Wait to pass.
+	// Load calls its thunk straight away, so queue keys with LoadThunk or LoadAll to batch them.
+	DispatchOnThunk bool
+
+	// Scheduler sends batches when its Dispatch is called, instead of once Wait has passed. Loaders sharing a
+	// scheduler have their batches sent together.
+	Scheduler *dataloader.Scheduler
+
+	// Registry registers the loader under its name, and unless Scheduler is set sends its batches with the
+	// registry's scheduler.
+	Registry *dataloader.Registry
+
+	// Hooks are called as the loader works, to record metrics or trace batches
+	Hooks *dataloader.Hooks
+
+	// Logger logs batches slower than SlowBatchThreshold, and warns when batches keep being sent with a single key
+	Logger *slog.Logger
+
+	// SlowBatchThreshold is how long fetch can take before the batch is logged, 0 never logs slow batches
+	SlowBatchThreshold time.Duration
+
+	// PanicHandler is called with any panic recovered from Fetch, after every waiter has been given the error.
+	// It can be used to log the panic, or to re-panic and crash like an unrecovered panic would.
+	PanicHandler func(err *dataloader.PanicError)
+
+	// CacheErrors decides which errors returned by Fetch are cached and replayed to later loads of the same key.
+	// nil caches no errors, dataloader.CacheAllErrors caches every error.
+	CacheErrors func(err error) bool
+}
+
+// NewUserSliceLoader creates a new UserSliceLoader given a fetch, wait, and maxBatch
+func NewUserSliceLoader(config UserSliceLoaderConfig) *UserSliceLoader {
+	l := &UserSliceLoader{
+		fetch:              config.Fetch,
+		wait:               config.Wait,
+		maxBatch:           config.MaxBatch,
+		dispatchOnThunk:    config.DispatchOnThunk,
+		scheduler:          config.Scheduler,
+		hooks:              config.Hooks,
+		logger:             config.Logger,
+		slowBatchThreshold: config.SlowBatchThreshold,
+		panicHandler:       config.PanicHandler,
+		cacheErrors:        config.CacheErrors,
+		notFound:           config.NotFound,
+	}
+	if config.Registry != nil {
+		if l.scheduler == nil {
+			l.scheduler = config.Registry.Scheduler()
+		}
+		config.Registry.Register("UserSliceLoader", l)
+	}
+	return l
+}
+
+// UserSliceLoader batches and caches requests
+type UserSliceLoader struct {
+	// this method provides the data for the loader
+	fetch func(ctx context.Context, keys []int) ([][]example.User, []error)
+
+	// the error fetch returns for keys that don't exist
+	notFound error
+
+	// how long to done before sending a batch
+	wait time.Duration
+
+	// this will limit the maximum number of keys to send in one batch, 0 = no limit
+	maxBatch int
+
+	// send the batch as soon as one of its thunks is called
+	dispatchOnThunk bool
+
+	// sends batches in place of the timer, if set
+	scheduler *dataloader.Scheduler
+
+	// called as the loader works
+	hooks *dataloader.Hooks
+
+	// logs slow batches and loaders that aren't batching
+	logger *slog.Logger
+
+	// how long fetch can take before the batch is logged
+	slowBatchThreshold time.Duration
+
+	// called with any panic recovered from fetch
+	panicHandler func(err *dataloader.PanicError)
+
+	// decides which fetch errors are cached
+	cacheErrors func(err error) bool
+
+	// INTERNAL
+
+	// lazily created cache
+	cache map[int][]example.User
+
+	// counts the work done by the loader
+	stats dataloader.Stats
+
+	// how many batches in a row have been sent with a single key, only counted when there is a logger
+	singleKeyBatches int
+
+	// lazily created cache of errors picked by cacheErrors and keys that weren't found
+	errCache map[int]error
+
+	// the current batch. keys will continue to be collected until timeout is hit,
+	// then everything will be sent to the fetch method and out to the listeners
+	batch *userSliceLoaderBatch
+
+	// batches that have been started but haven't cached their results yet
+	inflight map[*userSliceLoaderBatch]bool
+
+	// mutex to prevent races
+	mu sync.Mutex
+}
+
+type userSliceLoaderBatch struct {
+	keys    []int
+	index   map[int]int
+	data    [][]example.User
+	error   []error
+	closing bool
+	done    chan struct{}
+	timer   *time.Timer
+	start   time.Time
+
+	// the context passed to fetch, detached from the first caller and cancelled once every waiter has given up
+	ctx     context.Context
+	cancel  context.CancelFunc
+	waiters int
+
+	// keys set or cleared since the batch started, their fetched results are stale and aren't cached
+	written map[int]bool
+	cleared bool
+}
+
+// Load a User by key, batching and caching will be applied automatically
+func (l *UserSliceLoader) Load(key int) ([]example.User, error) {
+	return l.LoadThunk(key)()
+}
+
+// LoadCtx loads a User by key, returning ctx.Err() as soon as ctx is done
+func (l *UserSliceLoader) LoadCtx(ctx context.Context, key int) ([]example.User, error) {
+	return l.LoadThunkCtx(ctx, key)()
+}
+
+// LoadOptional loads a User by key, returning false instead of an error if it doesn't exist
+func (l *UserSliceLoader) LoadOptional(key int) ([]example.User, bool, error) {
+	return l.optional(l.Load(key))
+}
+
+// LoadOptionalCtx loads a User by key, returning false instead of an error if it doesn't exist
+func (l *UserSliceLoader) LoadOptionalCtx(ctx context.Context, key int) ([]example.User, bool, error) {
+	return l.optional(l.LoadCtx(ctx, key))
+}
+
+// optional turns not found errors into a missing value
+func (l *UserSliceLoader) optional(value []example.User, err error) ([]example.User, bool, error) {
+	if err == nil {
+		return value, true, nil
+	}
+
+	var zero []example.User
+	if dataloader.IsNotFound(err, l.notFound) {
+		return zero, false, nil
+	}
+	return zero, false, err
+}
+
+// LoadThunk returns a function that when called will block waiting for a User.
+// This method should be used if you want one goroutine to make requests to many
+// different data loaders without blocking until the thunk is called.
+func (l *UserSliceLoader) LoadThunk(key int) func() ([]example.User, error) {
+	return l.LoadThunkCtx(context.Background(), key)
+}
+
+// LoadThunkCtx returns a function that when called will block waiting for a User, or until ctx is done.
+// The batch is fetched with a context carrying the values of the first caller to join it, which is only
+// cancelled once the context of every caller waiting on the batch has been cancelled.
+func (l *UserSliceLoader) LoadThunkCtx(ctx context.Context, key int) func() ([]example.User, error) {
+	l.hooks.Load("UserSliceLoader")
+	l.mu.Lock()
+	l.stats.Loads++
+	if it, ok := l.cache[key]; ok {
+		l.stats.Hits++
+		l.mu.Unlock()
+		l.hooks.CacheHit("UserSliceLoader")
+		return func() ([]example.User, error) {
+			return it, nil
+		}
+	}
+	if err, ok := l.errCache[key]; ok {
+		l.stats.Hits++
+		l.mu.Unlock()
+		l.hooks.CacheHit("UserSliceLoader")
+		return func() ([]example.User, error) {
+			var zero []example.User
+			return zero, err
+		}
+	}
+	if l.batch == nil {
+		l.batch = &userSliceLoaderBatch{index: map[int]int{}, done: make(chan struct{})}
+		l.batch.ctx, l.batch.cancel = context.WithCancel(context.WithoutCancel(ctx))
+		if l.inflight == nil {
+			l.inflight = map[*userSliceLoaderBatch]bool{}
+		}
+		l.inflight[l.batch] = true
+	}
+	batch := l.batch
+	pos := batch.keyIndex(l, key)
+	batch.waiters++
+	l.mu.Unlock()
+
+	stop := context.AfterFunc(ctx, func() {
+		l.mu.Lock()
+		batch.abandon(l)
+		l.mu.Unlock()
+	})
+
+	return func() ([]example.User, error) {
+		if l.dispatchOnThunk {
+			l.mu.Lock()
+			batch.dispatch(l)
+			l.mu.Unlock()
+		}
+
+		select {
+		case <-batch.done:
+			stop()
+		case <-ctx.Done():
+			var zero []example.User
+			return zero, ctx.Err()
+		}
+
+		return batch.result(pos)
+	}
+}
+
+// LoadAll fetches many keys at once. It will be broken into appropriate sized
+// sub batches depending on how the loader is configured
+func (l *UserSliceLoader) LoadAll(keys []int) ([][]example.User, []error) {
+	results := make([]func() ([]example.User, error), len(keys))
+
+	for i, key := range keys {
+		results[i] = l.LoadThunk(key)
+	}
+
+	users := make([][]example.User, len(keys))
+	errors := make([]error, len(keys))
+	for i, thunk := range results {
+		users[i], errors[i] = thunk()
+	}
+	return users, errors
+}
+
+// LoadAllCtx fetches many keys at once, any keys still pending when ctx is done will return ctx.Err()
+func (l *UserSliceLoader) LoadAllCtx(ctx context.Context, keys []int) ([][]example.User, []error) {
+	return l.LoadAllThunkCtx(ctx, keys)()
+}
+
+// LoadAllThunk returns a function that when called will block waiting for a Users.
+// This method should be used if you want one goroutine to make requests to many
+// different data loaders without blocking until the thunk is called.
+func (l *UserSliceLoader) LoadAllThunk(keys []int) func() ([][]example.User, []error) {
+	return l.LoadAllThunkCtx(context.Background(), keys)
+}
+
+// LoadAllThunkCtx returns a function that when called will block waiting for a Users, or until ctx is done.
+func (l *UserSliceLoader) LoadAllThunkCtx(ctx context.Context, keys []int) func() ([][]example.User, []error) {
+	results := make([]func() ([]example.User, error), len(keys))
+	for i, key := range keys {
+		results[i] = l.LoadThunkCtx(ctx, key)
+	}
+	return func() ([][]example.User, []error) {
+		users := make([][]example.User, len(keys))
+		errors := make([]error, len(keys))
+		for i, thunk := range results {
+			users[i], errors[i] = thunk()
+		}
+		return users, errors
+	}
+}
+
+// Prime the cache with the provided key and value. If the key already has a value, no change is made
+// and false is returned. Priming replaces any cached error for the key.
+// (To forcefully prime the cache, use Set.)
+func (l *UserSliceLoader) Prime(key int, value []example.User) bool {
+	l.mu.Lock()
+	var found bool
+	if _, found = l.cache[key]; !found {
+		l.unsafePrime(key, value)
+	}
+	l.mu.Unlock()
+	return !found
+}
+
+// PrimeMany primes the cache with every value whose key doesn't already have a value, returning how many were
+// primed
+func (l *UserSliceLoader) PrimeMany(values map[int][]example.User) int {
+	primed := 0
+	l.mu.Lock()
+	for key, value := range values {
+		if _, found := l.cache[key]; !found {
+			l.unsafePrime(key, value)
+			primed++
+		}
+	}
+	l.mu.Unlock()
+	return primed
+}
+
+// Set the value for key in the cache, replacing any value or error already cached for it
+func (l *UserSliceLoader) Set(key int, value []example.User) {
+	l.mu.Lock()
+	l.unsafePrime(key, value)
+	l.mu.Unlock()
+}
+
+// SetMany sets every value in the cache at once, replacing any values or errors already cached for their keys
+func (l *UserSliceLoader) SetMany(values map[int][]example.User) {
+	l.mu.Lock()
+	for key, value := range values {
+		l.unsafePrime(key, value)
+	}
+	l.mu.Unlock()
+}
+
+// Clear the value or error at key from the cache, if it exists
+func (l *UserSliceLoader) Clear(key int) {
+	l.mu.Lock()
+	l.unsafeClear(key)
+	l.mu.Unlock()
+}
+
+// ClearMany clears the values and errors at every key from the cache at once
+func (l *UserSliceLoader) ClearMany(keys []int) {
+	l.mu.Lock()
+	for _, key := range keys {
+		l.unsafeClear(key)
+	}
+	l.mu.Unlock()
+}
+
+// ClearAll clears every value and error from the cache
+func (l *UserSliceLoader) ClearAll() {
+	l.mu.Lock()
+	l.cache = nil
+	l.errCache = nil
+	for b := range l.inflight {
+		b.cleared = true
+	}
+	l.mu.Unlock()
+}
+
+// Peek returns the cached User for key, without loading it if it isn't cached
+func (l *UserSliceLoader) Peek(key int) ([]example.User, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	it, ok := l.cache[key]
+	return it, ok
+}
+
+// Has reports whether a User is cached for key
+func (l *UserSliceLoader) Has(key int) bool {
+	_, ok := l.Peek(key)
+	return ok
+}
+
+// Len is the number of cached Users
+func (l *UserSliceLoader) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.cache)
+}
+
+// Snapshot copies the cached Users
+func (l *UserSliceLoader) Snapshot() map[int][]example.User {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	snapshot := make(map[int][]example.User, len(l.cache))
+	for key, value := range l.cache {
+		snapshot[key] = value
+	}
+	return snapshot
+}
+
+// Flush sends the current batch straight away, instead of waiting for it to fill up or for wait to pass
+func (l *UserSliceLoader) Flush() {
+	l.mu.Lock()
+	if l.batch != nil {
+		l.batch.dispatch(l)
+	}
+	l.mu.Unlock()
+}
+
+// logBatch logs batches slower than slowBatchThreshold, and warns when batches keep being sent with a single key
+func (l *UserSliceLoader) logBatch(keys []int, duration time.Duration) {
+	if l.logger == nil {
+		return
+	}
+
+	if l.slowBatchThreshold > 0 && duration >= l.slowBatchThreshold {
+		l.logger.Warn("slow dataloader batch", "loader", "UserSliceLoader", "keys", len(keys), "sample", dataloader.KeySample(keys), "duration", duration)
+	}
+
+	l.mu.Lock()
+	if len(keys) == 1 {
+		l.singleKeyBatches++
+	} else {
+		l.singleKeyBatches = 0
+	}
+	singleKeyBatches := l.singleKeyBatches
+	notBatching := singleKeyBatches > 0 && singleKeyBatches%dataloader.SingleKeyBatchWarning == 0
+	l.mu.Unlock()
+
+	if notBatching {
+		l.logger.Warn("dataloader is not batching", "loader", "UserSliceLoader", "singleKeyBatches", singleKeyBatches, "wait", l.wait)
+	}
+}
+
+// Stats counts the keys loaded and fetched by the loader
+func (l *UserSliceLoader) Stats() dataloader.Stats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.stats
+}
+
+func (l *UserSliceLoader) unsafeSet(key int, value []example.User) {
+	if l.cache == nil {
+		l.cache = map[int][]example.User{}
+	}
+	l.cache[key] = value
+	delete(l.errCache, key)
+}
+
+// unsafePrime stores a copy of value, its easy to pass a pointer in from a loop var and end up with the whole
+// cache pointing to the same value.
+func (l *UserSliceLoader) unsafePrime(key int, value []example.User) {
+	l.unsafeWritten(key)
+	cpy := make([]example.User, len(value))
+	copy(cpy, value)
+	l.unsafeSet(key, cpy)
+}
+
+func (l *UserSliceLoader) unsafeClear(key int) {
+	l.unsafeWritten(key)
+	delete(l.errCache, key)
+	delete(l.cache, key)
+}
+
+// unsafeWritten stops batches that are already in flight from caching a stale result over a write to key
+func (l *UserSliceLoader) unsafeWritten(key int) {
+	for b := range l.inflight {
+		if b.written == nil {
+			b.written = map[int]bool{}
+		}
+		b.written[key] = true
+	}
+}
+
+func (l *UserSliceLoader) unsafeSetError(key int, err error) {
+	if l.errCache == nil {
+		l.errCache = map[int]error{}
+	}
+	l.errCache[key] = err
+}
+
+// keyIndex will return the location of the key in the batch, if its not found
+// it will add the key to the batch
+func (b *userSliceLoaderBatch) keyIndex(l *UserSliceLoader, key int) int {
+	if i, ok := b.index[key]; ok {
+		return i
+	}
+
+	pos := len(b.keys)
+	b.keys = append(b.keys, key)
+	b.index[key] = pos
+	if pos == 0 {
+		b.startTimer(l)
+	}
+
+	if l.maxBatch != 0 && pos >= l.maxBatch-1 {
+		b.dispatch(l)
+	}
+
+	return pos
+}
+
+// startTimer schedules the batch to be sent once wait has passed, or by the scheduler if there is one.
+// The timer is stopped if the batch is closed early.
+func (b *userSliceLoaderBatch) startTimer(l *UserSliceLoader) {
+	b.start = time.Now()
+	if l.scheduler != nil {
+		l.scheduler.Schedule(func() {
+			l.mu.Lock()
+			b.dispatch(l)
+			l.mu.Unlock()
+		})
+		return
+	}
+
+	b.timer = time.AfterFunc(l.wait, func() {
+		b.timeout(l)
+	})
+}
+
+func (b *userSliceLoaderBatch) timeout(l *UserSliceLoader) {
+	l.mu.Lock()
+
+	// we must have hit a batch limit or been flushed and are already finalizing this batch
+	if b.closing {
+		l.mu.Unlock()
+		return
+	}
+
+	b.closing = true
+	l.batch = nil
+	l.mu.Unlock()
+
+	b.end(l)
+}
+
+// dispatch stops the batch collecting keys and sends it straight away, it must be called while holding the lock
+func (b *userSliceLoaderBatch) dispatch(l *UserSliceLoader) {
+	if b.closing {
+		return
+	}
+
+	b.closing = true
+	if b.timer != nil {
+		b.timer.Stop()
+	}
+	if l.batch == b {
+		l.batch = nil
+	}
+	go b.end(l)
+}
+
+func (b *userSliceLoaderBatch) end(l *UserSliceLoader) {
+	l.mu.Lock()
+	l.stats.Batches++
+	l.stats.Keys += len(b.keys)
+	l.mu.Unlock()
+
+	event := dataloader.BatchEvent{Loader: "UserSliceLoader", Keys: len(b.keys), Wait: time.Since(b.start)}
+	b.ctx = l.hooks.BatchStart(b.ctx, event)
+	start := time.Now()
+
+	panicErr := b.fetch(l)
+	duration := time.Since(start)
+	l.hooks.BatchEnd(b.ctx, event, duration, b.error)
+	l.logBatch(b.keys, duration)
+	l.mu.Lock()
+	b.cache(l)
+	l.mu.Unlock()
+	b.cancel()
+	close(b.done)
+
+	if panicErr != nil && l.panicHandler != nil {
+		l.panicHandler(panicErr)
+	}
+}
+
+// cache stores the results of the batch, unless every waiter gave up on it. Keys written since the
+// batch started keep what was written.
+func (b *userSliceLoaderBatch) cache(l *UserSliceLoader) {
+	delete(l.inflight, b)
+	if b.cleared || b.ctx.Err() != nil {
+		return
+	}
+
+	for pos, key := range b.keys {
+		if b.written[key] {
+			continue
+		}
+		data, err := b.result(pos)
+		if err == nil {
+			l.unsafeSet(key, data)
+		} else if dataloader.IsNotFound(err, l.notFound) || (l.cacheErrors != nil && l.cacheErrors(err)) {
+			l.unsafeSetError(key, err)
+		}
+	}
+}
+
+// result is the User and error fetched for the key at pos
+func (b *userSliceLoaderBatch) result(pos int) ([]example.User, error) {
+	var data []example.User
+	if pos < len(b.data) {
+		data = b.data[pos]
+	}
+
+	var err error
+	// its convenient to be able to return a single error for everything
+	if len(b.error) == 1 {
+		err = b.error[0]
+	} else if len(b.error) > 0 {
+		err = b.error[pos]
+	}
+	return data, err
+}
+
+// fetch calls the fetch func for the batch, any panic is recovered and returned to every waiter
+func (b *userSliceLoaderBatch) fetch(l *UserSliceLoader) (panicErr *dataloader.PanicError) {
+	defer func() {
+		if r := recover(); r != nil {
+			panicErr = dataloader.NewPanicError("UserSliceLoader", r)
+			b.data = nil
+			b.error = []error{panicErr}
+		}
+	}()
+
+	b.data, b.error = l.fetch(b.ctx, b.keys)
+	if err := dataloader.CheckBatchLength("UserSliceLoader", len(b.keys), len(b.data), b.error); err != nil {
+		b.data = nil
+		b.error = []error{err}
+	}
+	return nil
+}
+
+// abandon is called when the context of a waiter is done. Once every waiter has given up a batch that is still
+// collecting keys is dropped without being fetched, and a batch that is already being fetched has its context cancelled.
+func (b *userSliceLoaderBatch) abandon(l *UserSliceLoader) {
+	b.waiters--
+	if b.waiters > 0 {
+		return
+	}
+
+	if l.batch == b {
+		b.closing = true
+		if b.timer != nil {
+			b.timer.Stop()
+		}
+		l.batch = nil
+		delete(l.inflight, b)
+	}
+	b.cancel()
+}
@@ -0,0 +1,35 @@
+//go:generate go run github.com/vektah/dataloaden -result UserLoader string *github.com/vektah/dataloaden/example.User
+
+package result
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/vektah/dataloaden/example"
+	"github.com/vektah/dataloaden/pkg/dataloader"
+)
+
+// ErrUserNotFound is returned for users missing from the database
+var ErrUserNotFound = errors.New("user not found")
+
+// NewLoader will collect user requests for 2 milliseconds and send them as a single batch to the fetch func.
+// Each key gets its own result, so a missing user can't shift the rest of the batch out of line.
+func NewLoader() *UserLoader {
+	return NewUserLoader(UserLoaderConfig{
+		Wait:     2 * time.Millisecond,
+		MaxBatch: 100,
+		Fetch: func(keys []string) []dataloader.Result[*example.User] {
+			results := make([]dataloader.Result[*example.User], len(keys))
+			for i, key := range keys {
+				if strings.HasPrefix(key, "E") {
+					results[i].Err = ErrUserNotFound
+				} else {
+					results[i].Value = &example.User{ID: key, Name: "user " + key}
+				}
+			}
+			return results
+		},
+	})
+}
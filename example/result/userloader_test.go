@@ -0,0 +1,74 @@
+package result
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vektah/dataloaden/example"
+	"github.com/vektah/dataloaden/pkg/dataloader"
+)
+
+func TestUserLoader(t *testing.T) {
+	var fetches [][]string
+	var mu sync.Mutex
+
+	dl := NewUserLoader(UserLoaderConfig{
+		Wait:     10 * time.Millisecond,
+		MaxBatch: 5,
+		Fetch: func(keys []string) []dataloader.Result[*example.User] {
+			mu.Lock()
+			fetches = append(fetches, keys)
+			mu.Unlock()
+
+			results := make([]dataloader.Result[*example.User], len(keys))
+			for i, key := range keys {
+				if key[0] == 'E' {
+					results[i].Err = ErrUserNotFound
+				} else {
+					results[i].Value = &example.User{ID: key, Name: "user " + key}
+				}
+			}
+			return results
+		},
+	})
+
+	t.Run("results are lined up with the keys", func(t *testing.T) {
+		results := dl.LoadAll([]string{"U1", "E1", "U2"})
+		require.Len(t, results, 3)
+		require.NoError(t, results[0].Err)
+		require.Equal(t, "user U1", results[0].Value.Name)
+		require.Equal(t, ErrUserNotFound, results[1].Err)
+		require.Nil(t, results[1].Value)
+		require.NoError(t, results[2].Err)
+		require.Equal(t, "user U2", results[2].Value.Name)
+	})
+
+	t.Run("load still returns a value and error", func(t *testing.T) {
+		u, err := dl.Load("U1")
+		require.NoError(t, err)
+		require.Equal(t, "user U1", u.Name)
+		require.Len(t, fetches, 1)
+	})
+
+	t.Run("thunks return results", func(t *testing.T) {
+		thunk := dl.LoadAllThunk([]string{"U3", "E2"})
+		results := thunk()
+		require.Equal(t, "user U3", results[0].Value.Name)
+		require.Equal(t, ErrUserNotFound, results[1].Err)
+	})
+
+	t.Run("fetches returning the wrong number of results fail the batch", func(t *testing.T) {
+		dl := NewUserLoader(UserLoaderConfig{
+			Fetch: func(keys []string) []dataloader.Result[*example.User] {
+				return nil
+			},
+		})
+
+		results := dl.LoadAll([]string{"U1", "U2"})
+		var lengthErr *dataloader.BatchLengthError
+		require.ErrorAs(t, results[0].Err, &lengthErr)
+		require.ErrorAs(t, results[1].Err, &lengthErr)
+	})
+}
@@ -1,7 +1,13 @@
 package example
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"runtime"
+	"strconv"
 	"strings"
 	"sync"
 	"testing"
@@ -9,6 +15,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/vektah/dataloaden/pkg/dataloader"
 )
 
 func TestUserLoader(t *testing.T) {
@@ -169,6 +176,7 @@ func TestUserLoader(t *testing.T) {
 
 	t.Run("cleared results will go back to the fetcher", func(t *testing.T) {
 		dl.Clear("U99")
+		require.False(t, dl.Has("U99"))
 		u, err := dl.Load("U99")
 		require.NoError(t, err)
 		require.Equal(t, "user U99", u.Name)
@@ -194,3 +202,495 @@ func TestUserLoader(t *testing.T) {
 		require.Equal(t, "user U6", users2[0].Name)
 	})
 }
+
+func TestUserLoaderBatchLength(t *testing.T) {
+	dl := NewUserLoader(UserLoaderConfig{
+		Wait: time.Millisecond,
+		Fetch: func(keys []string) ([]*User, []error) {
+			return make([]*User, len(keys)-1), make([]error, 2)
+		},
+	})
+
+	_, errs := dl.LoadAll([]string{"U1", "U2", "U3"})
+	for _, err := range errs {
+		var lengthErr *dataloader.BatchLengthError
+		require.True(t, errors.As(err, &lengthErr))
+		require.Equal(t, &dataloader.BatchLengthError{Loader: "UserLoader", Keys: 3, Values: 2, Errors: 2}, lengthErr)
+	}
+	require.EqualError(t, errs[0], "UserLoader: fetch returned 2 values and 2 errors for 3 keys")
+
+	dl = NewUserLoader(UserLoaderConfig{
+		Wait: time.Millisecond,
+		Fetch: func(keys []string) ([]*User, []error) {
+			return make([]*User, len(keys)), []error{}
+		},
+	})
+	_, errs = dl.LoadAll([]string{"U1", "U2"})
+	require.Equal(t, []error{nil, nil}, errs, "an empty error slice means there were no errors")
+}
+
+func TestUserLoaderPanic(t *testing.T) {
+	handled := make(chan *dataloader.PanicError, 1)
+	dl := NewUserLoader(UserLoaderConfig{
+		Wait: time.Millisecond,
+		Fetch: func(keys []string) ([]*User, []error) {
+			panic("database exploded")
+		},
+		PanicHandler: func(err *dataloader.PanicError) {
+			handled <- err
+		},
+	})
+
+	_, errs := dl.LoadAll([]string{"U1", "U2"})
+	for _, err := range errs {
+		var panicErr *dataloader.PanicError
+		require.True(t, errors.As(err, &panicErr))
+		require.Equal(t, "database exploded", panicErr.Value)
+		require.Contains(t, string(panicErr.Stack), "TestUserLoaderPanic")
+	}
+	require.EqualError(t, errs[0], "UserLoader: panic in fetch: database exploded")
+	require.Equal(t, errs[0], <-handled)
+}
+
+func TestUserLoaderCacheErrors(t *testing.T) {
+	errNotFound := errors.New("user not found")
+	var fetches int
+	dl := NewUserLoader(UserLoaderConfig{
+		Wait: time.Millisecond,
+		Fetch: func(keys []string) ([]*User, []error) {
+			fetches++
+			users := make([]*User, len(keys))
+			errors := make([]error, len(keys))
+			for i, key := range keys {
+				switch key[0] {
+				case 'E':
+					errors[i] = errNotFound
+				case 'T':
+					errors[i] = fmt.Errorf("timeout")
+				default:
+					users[i] = &User{ID: key, Name: "user " + key}
+				}
+			}
+			return users, errors
+		},
+		CacheErrors: func(err error) bool {
+			return errors.Is(err, errNotFound)
+		},
+	})
+
+	_, errs := dl.LoadAll([]string{"E1", "T1"})
+	require.Equal(t, errNotFound, errs[0])
+	require.Error(t, errs[1])
+	require.Equal(t, 1, fetches)
+
+	t.Run("matching errors are replayed from the cache", func(t *testing.T) {
+		u, err := dl.Load("E1")
+		require.Equal(t, errNotFound, err)
+		require.Nil(t, u)
+		require.Equal(t, 1, fetches)
+	})
+
+	t.Run("other errors go back to the fetcher", func(t *testing.T) {
+		_, err := dl.Load("T1")
+		require.Error(t, err)
+		require.Equal(t, 2, fetches)
+	})
+
+	t.Run("cleared errors go back to the fetcher", func(t *testing.T) {
+		dl.Clear("E1")
+		_, err := dl.Load("E1")
+		require.Equal(t, errNotFound, err)
+		require.Equal(t, 3, fetches)
+	})
+
+	t.Run("priming replaces a cached error", func(t *testing.T) {
+		require.True(t, dl.Prime("E1", &User{ID: "E1", Name: "Primed user"}))
+		u, err := dl.Load("E1")
+		require.NoError(t, err)
+		require.Equal(t, "Primed user", u.Name)
+		require.Equal(t, 3, fetches)
+	})
+}
+
+func TestUserLoaderFullBatchStopsTimer(t *testing.T) {
+	dl := &UserLoader{
+		wait:     time.Hour,
+		maxBatch: 2,
+		fetch: func(keys []string) ([]*User, []error) {
+			return make([]*User, len(keys)), nil
+		},
+	}
+
+	before := runtime.NumGoroutine()
+	for i := 0; i < 100; i += 2 {
+		dl.LoadAll([]string{strconv.Itoa(i), strconv.Itoa(i + 1)})
+	}
+
+	// give the goroutines sending each batch a moment to exit
+	for i := 0; i < 100 && runtime.NumGoroutine() > before; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.LessOrEqual(t, runtime.NumGoroutine(), before, "full batches should not leave anything waiting on the timer")
+}
+
+func TestUserLoaderFlush(t *testing.T) {
+	var fetches [][]string
+	dl := &UserLoader{
+		wait: time.Hour,
+		fetch: func(keys []string) ([]*User, []error) {
+			fetches = append(fetches, keys)
+			return make([]*User, len(keys)), nil
+		},
+	}
+
+	t.Run("flush sends the batch without waiting", func(t *testing.T) {
+		thunk := dl.LoadAllThunk([]string{"U1", "U2"})
+		dl.Flush()
+		_, errs := thunk()
+		require.Equal(t, []error{nil, nil}, errs)
+		require.Equal(t, [][]string{{"U1", "U2"}}, fetches)
+	})
+
+	t.Run("flush does nothing without a batch", func(t *testing.T) {
+		dl.Flush()
+		require.Len(t, fetches, 1)
+	})
+
+	t.Run("calling a thunk sends its batch", func(t *testing.T) {
+		dl.dispatchOnThunk = true
+		_, errs := dl.LoadAll([]string{"U3", "U4"})
+		require.Equal(t, []error{nil, nil}, errs)
+		require.Equal(t, []string{"U3", "U4"}, fetches[1])
+	})
+}
+
+func TestUserLoaderScheduler(t *testing.T) {
+	var fetches [][]string
+	var mu sync.Mutex
+	scheduler := dataloader.NewScheduler()
+	dl := &UserLoader{
+		scheduler: scheduler,
+		fetch: func(keys []string) ([]*User, []error) {
+			mu.Lock()
+			fetches = append(fetches, keys)
+			mu.Unlock()
+			return make([]*User, len(keys)), nil
+		},
+	}
+
+	thunk := dl.LoadAllThunk([]string{"U1", "U2"})
+	time.Sleep(10 * time.Millisecond)
+	mu.Lock()
+	require.Empty(t, fetches, "nothing is sent until the scheduler dispatches")
+	mu.Unlock()
+
+	scheduler.Dispatch()
+	_, errs := thunk()
+	require.Equal(t, []error{nil, nil}, errs)
+	require.Equal(t, [][]string{{"U1", "U2"}}, fetches)
+}
+
+func TestUserLoaderRegistry(t *testing.T) {
+	registry := dataloader.NewRegistry(0)
+	dl := NewUserLoader(UserLoaderConfig{
+		Registry: registry,
+		Fetch: func(keys []string) ([]*User, []error) {
+			return make([]*User, len(keys)), nil
+		},
+	})
+	require.Equal(t, dl, registry.Get("UserLoader"))
+
+	thunk := dl.LoadAllThunk([]string{"U1", "U2", "U1"})
+	registry.Flush()
+	_, errs := thunk()
+	require.Equal(t, []error{nil, nil, nil}, errs)
+
+	dl.Load("U1")
+	require.Equal(t, dataloader.Stats{Loads: 4, Hits: 1, Batches: 1, Keys: 2}, registry.Stats())
+
+	other := NewUserLoader(UserLoaderConfig{
+		Registry: registry,
+		Fetch: func(keys []string) ([]*User, []error) {
+			return make([]*User, len(keys)), nil
+		},
+	})
+	require.Equal(t, []string{"UserLoader", "UserLoader#2"}, registry.Names())
+	require.Equal(t, other, registry.Get("UserLoader#2"))
+}
+
+func TestUserLoaderHooks(t *testing.T) {
+	var loads, hits int
+	var batches []dataloader.BatchEvent
+	dl := NewUserLoader(UserLoaderConfig{
+		Wait: time.Millisecond,
+		Hooks: &dataloader.Hooks{
+			OnLoad:     func(loader string) { loads++ },
+			OnCacheHit: func(loader string) { hits++ },
+			OnBatchEnd: func(ctx context.Context, batch dataloader.BatchEvent) {
+				batches = append(batches, batch)
+			},
+		},
+		Fetch: func(keys []string) ([]*User, []error) {
+			return make([]*User, len(keys)), []error{nil, errors.New("failed")}
+		},
+	})
+
+	dl.LoadAll([]string{"U1", "U2"})
+	dl.Load("U1")
+
+	require.Equal(t, 3, loads)
+	require.Equal(t, 1, hits)
+	require.Len(t, batches, 1)
+	require.Equal(t, "UserLoader", batches[0].Loader)
+	require.Equal(t, 2, batches[0].Keys)
+	require.Equal(t, 1, batches[0].Errors)
+}
+
+func TestUserLoaderLogger(t *testing.T) {
+	var buf bytes.Buffer
+	dl := NewUserLoader(UserLoaderConfig{
+		Wait:               time.Millisecond,
+		Logger:             slog.New(slog.NewTextHandler(&buf, nil)),
+		SlowBatchThreshold: 5 * time.Millisecond,
+		Fetch: func(keys []string) ([]*User, []error) {
+			if len(keys) > 1 {
+				time.Sleep(10 * time.Millisecond)
+			}
+			return make([]*User, len(keys)), nil
+		},
+	})
+
+	dl.LoadAll([]string{"U1", "U2", "U3", "U4", "U5", "U6"})
+	require.Contains(t, buf.String(), `msg="slow dataloader batch" loader=UserLoader keys=6 sample="[U1 U2 U3 U4 U5]"`)
+
+	buf.Reset()
+	for i := 1; i < dataloader.SingleKeyBatchWarning; i++ {
+		dl.Load("S" + strconv.Itoa(i))
+	}
+	require.Empty(t, buf.String())
+
+	dl.Load("S")
+	require.Contains(t, buf.String(), `msg="dataloader is not batching" loader=UserLoader singleKeyBatches=10`)
+	require.NotContains(t, buf.String(), "slow dataloader batch")
+}
+
+func TestUserLoaderNotFound(t *testing.T) {
+	var fetches [][]string
+	var mu sync.Mutex
+	dbErr := errors.New("database is down")
+
+	dl := NewUserLoader(UserLoaderConfig{
+		Wait: time.Millisecond,
+		Fetch: func(keys []string) ([]*User, []error) {
+			mu.Lock()
+			fetches = append(fetches, keys)
+			mu.Unlock()
+
+			users := make([]*User, len(keys))
+			errs := make([]error, len(keys))
+			for i, key := range keys {
+				switch key[0] {
+				case 'E':
+					errs[i] = fmt.Errorf("user %s: %w", key, dataloader.ErrNotFound)
+				case 'F':
+					errs[i] = dbErr
+				default:
+					users[i] = &User{ID: key, Name: "user " + key}
+				}
+			}
+			return users, errs
+		},
+	})
+
+	u, ok, err := dl.LoadOptional("U1")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "user U1", u.Name)
+
+	u, ok, err = dl.LoadOptional("E1")
+	require.NoError(t, err)
+	require.False(t, ok)
+	require.Nil(t, u)
+
+	_, ok, err = dl.LoadOptional("F1")
+	require.Equal(t, dbErr, err)
+	require.False(t, ok)
+
+	t.Run("absence is cached, other errors are not", func(t *testing.T) {
+		_, err := dl.Load("E1")
+		require.ErrorIs(t, err, dataloader.ErrNotFound)
+		_, err = dl.Load("F1")
+		require.Equal(t, dbErr, err)
+		require.Equal(t, [][]string{{"U1"}, {"E1"}, {"F1"}, {"F1"}}, fetches)
+	})
+
+	t.Run("clearing a missing key fetches it again", func(t *testing.T) {
+		dl.Clear("E1")
+		_, ok, err := dl.LoadOptional("E1")
+		require.NoError(t, err)
+		require.False(t, ok)
+		require.Len(t, fetches, 5)
+	})
+}
+
+func TestUserLoaderPeek(t *testing.T) {
+	fetches := 0
+	dl := NewUserLoader(UserLoaderConfig{
+		Wait: time.Millisecond,
+		Fetch: func(keys []string) ([]*User, []error) {
+			fetches++
+			users := make([]*User, len(keys))
+			for i, key := range keys {
+				users[i] = &User{ID: key, Name: "user " + key}
+			}
+			return users, nil
+		},
+	})
+
+	u, ok := dl.Peek("U1")
+	require.False(t, ok)
+	require.Nil(t, u)
+	require.False(t, dl.Has("U1"))
+	require.Equal(t, 0, dl.Len())
+	require.Empty(t, dl.Snapshot())
+
+	dl.LoadAll([]string{"U1", "U2"})
+	u, ok = dl.Peek("U1")
+	require.True(t, ok)
+	require.Equal(t, "user U1", u.Name)
+	require.True(t, dl.Has("U2"))
+	require.Equal(t, 2, dl.Len())
+
+	snapshot := dl.Snapshot()
+	require.Len(t, snapshot, 2)
+	require.Equal(t, "user U2", snapshot["U2"].Name)
+	delete(snapshot, "U1")
+	require.True(t, dl.Has("U1"), "the snapshot is a copy")
+
+	require.Equal(t, 1, fetches)
+	require.Equal(t, dataloader.Stats{Loads: 2, Batches: 1, Keys: 2}, dl.Stats(), "peeking isn't a load")
+}
+
+func TestUserLoaderWritesDuringFetch(t *testing.T) {
+	scheduler := dataloader.NewScheduler()
+	dl := NewUserLoader(UserLoaderConfig{
+		Scheduler: scheduler,
+		Fetch: func(keys []string) ([]*User, []error) {
+			users := make([]*User, len(keys))
+			for i, key := range keys {
+				users[i] = &User{ID: key, Name: "stale"}
+			}
+			return users, nil
+		},
+	})
+
+	thunk := dl.LoadAllThunk([]string{"U1", "U2", "U3"})
+	dl.Set("U1", &User{ID: "U1", Name: "fresh"})
+	dl.Clear("U2")
+	scheduler.Dispatch()
+	thunk()
+
+	u, _ := dl.Peek("U1")
+	require.Equal(t, "fresh", u.Name, "values set during a fetch aren't replaced")
+	require.False(t, dl.Has("U2"), "keys cleared during a fetch aren't cached")
+	require.True(t, dl.Has("U3"))
+}
+
+func TestUserLoaderBulkCache(t *testing.T) {
+	var fetches [][]string
+	var mu sync.Mutex
+	dl := NewUserLoader(UserLoaderConfig{
+		Wait: time.Millisecond,
+		Fetch: func(keys []string) ([]*User, []error) {
+			mu.Lock()
+			fetches = append(fetches, keys)
+			mu.Unlock()
+
+			users := make([]*User, len(keys))
+			errs := make([]error, len(keys))
+			for i, key := range keys {
+				if key[0] == 'E' {
+					errs[i] = dataloader.ErrNotFound
+				} else {
+					users[i] = &User{ID: key, Name: "user " + key}
+				}
+			}
+			return users, errs
+		},
+	})
+
+	dl.LoadAll([]string{"U1", "U2", "U3", "E1"})
+	require.Len(t, fetches, 1)
+
+	t.Run("set overwrites cached values and errors", func(t *testing.T) {
+		dl.Set("U1", &User{ID: "U1", Name: "renamed"})
+		dl.Set("E1", &User{ID: "E1", Name: "created"})
+
+		u, err := dl.Load("U1")
+		require.NoError(t, err)
+		require.Equal(t, "renamed", u.Name)
+		u, err = dl.Load("E1")
+		require.NoError(t, err)
+		require.Equal(t, "created", u.Name)
+		require.Len(t, fetches, 1)
+	})
+
+	t.Run("setting in a loop is safe", func(t *testing.T) {
+		users := []User{{ID: "Alpha", Name: "Alpha"}, {ID: "Omega", Name: "Omega"}}
+		for _, user := range users {
+			dl.Set(user.ID, &user)
+		}
+
+		u, _ := dl.Peek("Alpha")
+		require.Equal(t, "Alpha", u.Name)
+	})
+
+	t.Run("prime many skips keys that already have a value", func(t *testing.T) {
+		require.Equal(t, 1, dl.PrimeMany(map[string]*User{
+			"U1": {ID: "U1", Name: "ignored"},
+			"U4": {ID: "U4", Name: "primed"},
+		}))
+
+		users, errs := dl.LoadAll([]string{"U1", "U4"})
+		require.Equal(t, []error{nil, nil}, errs)
+		require.Equal(t, "renamed", users[0].Name)
+		require.Equal(t, "primed", users[1].Name)
+		require.Len(t, fetches, 1)
+	})
+
+	t.Run("set many overwrites every key", func(t *testing.T) {
+		dl.SetMany(map[string]*User{
+			"U1": {ID: "U1", Name: "set U1"},
+			"U2": {ID: "U2", Name: "set U2"},
+		})
+
+		users, _ := dl.LoadAll([]string{"U1", "U2"})
+		require.Equal(t, "set U1", users[0].Name)
+		require.Equal(t, "set U2", users[1].Name)
+		require.Len(t, fetches, 1)
+	})
+
+	t.Run("clear many sends the keys back to the fetcher", func(t *testing.T) {
+		dl.ClearMany([]string{"U1", "U2"})
+		require.False(t, dl.Has("U1"))
+		require.False(t, dl.Has("U2"))
+		require.True(t, dl.Has("U3"))
+
+		users, _ := dl.LoadAll([]string{"U1", "U2", "U3"})
+		require.Equal(t, "user U1", users[0].Name)
+		require.Len(t, fetches, 2)
+		require.Equal(t, []string{"U1", "U2"}, fetches[1])
+	})
+
+	t.Run("clear all empties the cache", func(t *testing.T) {
+		dl.Load("E2")
+		require.Len(t, fetches, 3)
+
+		dl.ClearAll()
+		require.Equal(t, 0, dl.Len())
+
+		dl.LoadAll([]string{"U3", "E2"})
+		require.Len(t, fetches, 4)
+		require.Equal(t, []string{"U3", "E2"}, fetches[3], "cached errors are cleared too")
+	})
+}
@@ -0,0 +1,362 @@
+package dataloader
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Cache stores the values fetched by a loader. Loaders only call it while holding their own lock, so an
+// implementation only needs to be safe for concurrent use if it is shared between loaders.
+type Cache[K comparable, V any] interface {
+	// Get returns the value for key and whether it was found
+	Get(key K) (V, bool)
+
+	// Set stores value for key, replacing any existing value or error
+	Set(key K, value V)
+
+	// Delete removes the value or error at key from the cache, if it exists
+	Delete(key K)
+
+	// Clear removes every value and error from the cache
+	Clear()
+}
+
+// ErrorCache is implemented by caches that can also store errors, loaders need it to cache keys that weren't found
+// and errors picked by CacheErrors, which then expire and are evicted like values. Every cache in this package
+// implements it.
+type ErrorCache[K comparable] interface {
+	// GetError returns the error for key and whether it was found, Get doesn't find keys holding an error
+	GetError(key K) (error, bool)
+
+	// SetError stores err for key, replacing any existing value or error
+	SetError(key K, err error)
+}
+
+// Ranger is implemented by caches that can list their values, loaders need it for Len and Snapshot. Every cache in
+// this package implements it.
+type Ranger[K comparable, V any] interface {
+	// Range calls f for each value in the cache, stopping early if f returns false
+	Range(f func(key K, value V) bool)
+}
+
+// CacheLen counts the values in cache, it is 0 if cache is nil or doesn't implement Ranger
+func CacheLen[K comparable, V any](cache Cache[K, V]) int {
+	n := 0
+	if r, ok := cache.(Ranger[K, V]); ok {
+		r.Range(func(K, V) bool {
+			n++
+			return true
+		})
+	}
+	return n
+}
+
+// CacheGetError returns the error cached for key, it is never found if cache is nil or doesn't implement ErrorCache
+func CacheGetError[K comparable, V any](cache Cache[K, V], key K) (error, bool) {
+	if ec, ok := cache.(ErrorCache[K]); ok {
+		return ec.GetError(key)
+	}
+	return nil, false
+}
+
+// CacheSetError caches err for key, it is dropped if cache doesn't implement ErrorCache
+func CacheSetError[K comparable, V any](cache Cache[K, V], key K, err error) {
+	if ec, ok := cache.(ErrorCache[K]); ok {
+		ec.SetError(key, err)
+	}
+}
+
+// CacheSnapshot copies the values in cache, it is empty if cache is nil or doesn't implement Ranger
+func CacheSnapshot[K comparable, V any](cache Cache[K, V]) map[K]V {
+	snapshot := map[K]V{}
+	if r, ok := cache.(Ranger[K, V]); ok {
+		r.Range(func(key K, value V) bool {
+			snapshot[key] = value
+			return true
+		})
+	}
+	return snapshot
+}
+
+// NewMapCache creates an unbounded cache backed by a map. This is what loaders use when no cache is configured,
+// it is intended for short lived request scoped loaders.
+func NewMapCache[K comparable, V any]() Cache[K, V] {
+	return mapCache[K, V]{}
+}
+
+type mapCache[K comparable, V any] map[K]cacheEntry[V]
+
+// cacheEntry holds a value, or the error fetch returned for its key
+type cacheEntry[V any] struct {
+	value V
+	err   error
+}
+
+func (c mapCache[K, V]) Get(key K) (V, bool) {
+	it, ok := c[key]
+	if !ok || it.err != nil {
+		var zero V
+		return zero, false
+	}
+	return it.value, true
+}
+
+func (c mapCache[K, V]) GetError(key K) (error, bool) {
+	it, ok := c[key]
+	if !ok || it.err == nil {
+		return nil, false
+	}
+	return it.err, true
+}
+
+func (c mapCache[K, V]) Set(key K, value V) {
+	c[key] = cacheEntry[V]{value: value}
+}
+
+func (c mapCache[K, V]) SetError(key K, err error) {
+	c[key] = cacheEntry[V]{err: err}
+}
+
+func (c mapCache[K, V]) Delete(key K) {
+	delete(c, key)
+}
+
+func (c mapCache[K, V]) Clear() {
+	for k := range c {
+		delete(c, k)
+	}
+}
+
+// Range skips keys holding an error
+func (c mapCache[K, V]) Range(f func(key K, value V) bool) {
+	for k, it := range c {
+		if it.err == nil && !f(k, it.value) {
+			return
+		}
+	}
+}
+
+// NewLRUCache creates a cache holding at most size values and errors, evicting the least recently used when full.
+// It is safe for concurrent use.
+func NewLRUCache[K comparable, V any](size int) Cache[K, V] {
+	if size < 1 {
+		panic("dataloader: LRU cache size must be at least 1")
+	}
+	return &lruCache[K, V]{
+		size:  size,
+		order: list.New(),
+		items: map[K]*list.Element{},
+	}
+}
+
+type lruCache[K comparable, V any] struct {
+	size  int
+	order *list.List
+	items map[K]*list.Element
+	mu    sync.Mutex
+}
+
+type lruEntry[K comparable, V any] struct {
+	key K
+	cacheEntry[V]
+}
+
+func (c *lruCache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok || el.Value.(*lruEntry[K, V]).err != nil {
+		var zero V
+		return zero, false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*lruEntry[K, V]).value, true
+}
+
+func (c *lruCache[K, V]) GetError(key K) (error, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok || el.Value.(*lruEntry[K, V]).err == nil {
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*lruEntry[K, V]).err, true
+}
+
+func (c *lruCache[K, V]) Set(key K, value V) {
+	c.set(key, cacheEntry[V]{value: value})
+}
+
+func (c *lruCache[K, V]) SetError(key K, err error) {
+	c.set(key, cacheEntry[V]{err: err})
+}
+
+func (c *lruCache[K, V]) set(key K, entry cacheEntry[V]) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		el.Value.(*lruEntry[K, V]).cacheEntry = entry
+		c.order.MoveToFront(el)
+		return
+	}
+
+	c.items[key] = c.order.PushFront(&lruEntry[K, V]{key: key, cacheEntry: entry})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*lruEntry[K, V]).key)
+	}
+}
+
+func (c *lruCache[K, V]) Delete(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		c.order.Remove(el)
+		delete(c.items, key)
+	}
+}
+
+func (c *lruCache[K, V]) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.order.Init()
+	c.items = map[K]*list.Element{}
+}
+
+// Range lists the values from most to least recently used, without changing how recently they were used. Keys
+// holding an error are skipped.
+func (c *lruCache[K, V]) Range(f func(key K, value V) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for el := c.order.Front(); el != nil; el = el.Next() {
+		entry := el.Value.(*lruEntry[K, V])
+		if entry.err == nil && !f(entry.key, entry.value) {
+			return
+		}
+	}
+}
+
+// NewTTLCache creates a cache where values and errors expire ttl after they were set. Expired values are removed when they
+// are next read, or swept out on Set once every ttl. It is safe for concurrent use.
+func NewTTLCache[K comparable, V any](ttl time.Duration) Cache[K, V] {
+	if ttl <= 0 {
+		panic("dataloader: TTL cache ttl must be positive")
+	}
+	return &ttlCache[K, V]{
+		ttl:   ttl,
+		now:   time.Now,
+		items: map[K]ttlEntry[V]{},
+	}
+}
+
+type ttlCache[K comparable, V any] struct {
+	ttl       time.Duration
+	now       func() time.Time
+	lastSweep time.Time
+	items     map[K]ttlEntry[V]
+	mu        sync.Mutex
+}
+
+type ttlEntry[V any] struct {
+	cacheEntry[V]
+	expires time.Time
+}
+
+func (c *ttlCache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	it, ok := c.get(key)
+	if !ok || it.err != nil {
+		var zero V
+		return zero, false
+	}
+	return it.value, true
+}
+
+func (c *ttlCache[K, V]) GetError(key K) (error, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	it, ok := c.get(key)
+	if !ok || it.err == nil {
+		return nil, false
+	}
+	return it.err, true
+}
+
+// get returns the entry for key, removing it if it has expired
+func (c *ttlCache[K, V]) get(key K) (ttlEntry[V], bool) {
+	it, ok := c.items[key]
+	if ok && !c.now().Before(it.expires) {
+		delete(c.items, key)
+		return ttlEntry[V]{}, false
+	}
+	return it, ok
+}
+
+func (c *ttlCache[K, V]) Set(key K, value V) {
+	c.set(key, cacheEntry[V]{value: value})
+}
+
+func (c *ttlCache[K, V]) SetError(key K, err error) {
+	c.set(key, cacheEntry[V]{err: err})
+}
+
+func (c *ttlCache[K, V]) set(key K, entry cacheEntry[V]) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if now.Sub(c.lastSweep) >= c.ttl {
+		for k, it := range c.items {
+			if !now.Before(it.expires) {
+				delete(c.items, k)
+			}
+		}
+		c.lastSweep = now
+	}
+
+	c.items[key] = ttlEntry[V]{cacheEntry: entry, expires: now.Add(c.ttl)}
+}
+
+func (c *ttlCache[K, V]) Delete(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.items, key)
+}
+
+func (c *ttlCache[K, V]) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.items = map[K]ttlEntry[V]{}
+}
+
+// Range skips values that have expired and keys holding an error
+func (c *ttlCache[K, V]) Range(f func(key K, value V) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	for k, it := range c.items {
+		if now.Before(it.expires) && it.err == nil && !f(k, it.value) {
+			return
+		}
+	}
+}
+
+// CacheAllErrors can be used as Config.CacheErrors to cache every error returned by fetch
+func CacheAllErrors(err error) bool {
+	return true
+}
@@ -0,0 +1,148 @@
+package dataloader
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLRUCache(t *testing.T) {
+	c := NewLRUCache[int, string](2)
+	c.Set(1, "one")
+	c.Set(2, "two")
+
+	_, ok := c.Get(1)
+	require.True(t, ok)
+
+	c.Set(3, "three")
+	_, ok = c.Get(2)
+	require.False(t, ok, "2 was the least recently used")
+
+	v, ok := c.Get(1)
+	require.True(t, ok)
+	require.Equal(t, "one", v)
+
+	c.Set(1, "uno")
+	v, _ = c.Get(1)
+	require.Equal(t, "uno", v)
+
+	require.Equal(t, map[int]string{1: "uno", 3: "three"}, CacheSnapshot(c))
+	require.Equal(t, 2, CacheLen(c))
+
+	c.Get(3)
+
+	var order []int
+	c.(Ranger[int, string]).Range(func(key int, value string) bool {
+		order = append(order, key)
+		return true
+	})
+	require.Equal(t, []int{3, 1}, order, "most recently used first")
+
+	c.Delete(1)
+	_, ok = c.Get(1)
+	require.False(t, ok)
+
+	c.Clear()
+	_, ok = c.Get(3)
+	require.False(t, ok)
+	require.Equal(t, 0, CacheLen(c))
+}
+
+func TestLRUCacheErrors(t *testing.T) {
+	failed := errors.New("failed")
+	c := NewLRUCache[int, string](2)
+	c.Set(1, "one")
+	CacheSetError(c, 2, failed)
+
+	_, ok := c.Get(2)
+	require.False(t, ok, "errors aren't values")
+	err, ok := CacheGetError(c, 2)
+	require.True(t, ok)
+	require.Equal(t, failed, err)
+	_, ok = CacheGetError(c, 1)
+	require.False(t, ok)
+	require.Equal(t, map[int]string{1: "one"}, CacheSnapshot(c))
+
+	c.Set(3, "three")
+	_, ok = c.Get(1)
+	require.False(t, ok, "errors take up space, so 1 was evicted")
+
+	c.Set(2, "two")
+	_, ok = CacheGetError(c, 2)
+	require.False(t, ok, "values replace errors")
+
+	CacheSetError(c, 4, failed)
+	CacheSetError(c, 5, failed)
+	_, ok = CacheGetError(c, 4)
+	require.True(t, ok)
+	require.Equal(t, 0, CacheLen(c), "errors are evicted like values")
+}
+
+func TestTTLCache(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewTTLCache[int, string](time.Minute).(*ttlCache[int, string])
+	c.now = func() time.Time { return now }
+
+	c.Set(1, "one")
+	now = now.Add(30 * time.Second)
+	c.Set(2, "two")
+
+	v, ok := c.Get(1)
+	require.True(t, ok)
+	require.Equal(t, "one", v)
+
+	now = now.Add(30 * time.Second)
+	_, ok = c.Get(1)
+	require.False(t, ok, "1 has expired")
+	_, ok = c.Get(2)
+	require.True(t, ok)
+	require.Equal(t, map[int]string{2: "two"}, CacheSnapshot[int, string](c), "expired values are skipped")
+
+	now = now.Add(2 * time.Minute)
+	c.Set(3, "three")
+	require.Len(t, c.items, 1, "expired values are swept on set")
+
+	c.Clear()
+	_, ok = c.Get(3)
+	require.False(t, ok)
+
+	require.PanicsWithValue(t, "dataloader: TTL cache ttl must be positive", func() {
+		NewTTLCache[int, string](0)
+	})
+}
+
+func TestTTLCacheErrors(t *testing.T) {
+	failed := errors.New("failed")
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewTTLCache[int, string](time.Minute).(*ttlCache[int, string])
+	c.now = func() time.Time { return now }
+
+	c.SetError(1, failed)
+	_, ok := c.Get(1)
+	require.False(t, ok, "errors aren't values")
+	err, ok := c.GetError(1)
+	require.True(t, ok)
+	require.Equal(t, failed, err)
+
+	now = now.Add(time.Minute)
+	_, ok = c.GetError(1)
+	require.False(t, ok, "errors expire like values")
+
+	c.SetError(2, failed)
+	c.Clear()
+	_, ok = c.GetError(2)
+	require.False(t, ok)
+}
+
+func TestCacheSnapshot(t *testing.T) {
+	require.Equal(t, map[int]string{}, CacheSnapshot[int, string](nil))
+	require.Equal(t, 0, CacheLen[int, string](nil))
+
+	c := NewMapCache[int, string]()
+	c.Set(1, "one")
+	CacheSetError(c, 2, errors.New("failed"))
+	require.Equal(t, map[int]string{1: "one"}, CacheSnapshot(c), "errors aren't values")
+	require.Equal(t, 1, CacheLen(c))
+}
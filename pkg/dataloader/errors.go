@@ -0,0 +1,80 @@
+package dataloader
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+)
+
+// ErrNotFound can be returned by fetch, as is or wrapped, for keys that don't exist. Keys that aren't found are
+// cached, and LoadOptional reports them as missing instead of as an error.
+var ErrNotFound = errors.New("not found")
+
+// IsNotFound reports whether err means the key doesn't exist, because it is ErrNotFound or the loader's own
+// notFound error, which may be nil
+func IsNotFound(err error, notFound error) bool {
+	return errors.Is(err, ErrNotFound) || (notFound != nil && errors.Is(err, notFound))
+}
+
+// BatchLengthError is returned to every waiter in a batch when fetch breaks its contract, by returning a different
+// number of values than keys, or a number of errors other than 0, 1 or one per key.
+type BatchLengthError struct {
+	// Loader is the name of the loader whose fetch returned the bad batch
+	Loader string
+
+	Keys   int
+	Values int
+	Errors int
+}
+
+func (e *BatchLengthError) Error() string {
+	return fmt.Sprintf("%s: fetch returned %d values and %d errors for %d keys", e.Loader, e.Values, e.Errors, e.Keys)
+}
+
+// CheckBatchLength validates the results of a fetch against the keys it was given. Values may only be omitted when
+// every key has an error.
+func CheckBatchLength(loader string, keys int, values int, errors []error) error {
+	if len(errors) > 1 && len(errors) != keys {
+		return &BatchLengthError{Loader: loader, Keys: keys, Values: values, Errors: len(errors)}
+	}
+	if values == keys || (values == 0 && allErrors(errors)) {
+		return nil
+	}
+	return &BatchLengthError{Loader: loader, Keys: keys, Values: values, Errors: len(errors)}
+}
+
+func allErrors(errors []error) bool {
+	for _, err := range errors {
+		if err == nil {
+			return false
+		}
+	}
+	return len(errors) > 0
+}
+
+// PanicError is returned to every waiter in a batch when fetch panics
+type PanicError struct {
+	// Loader is the name of the loader whose fetch panicked
+	Loader string
+
+	// Value is the value passed to panic
+	Value interface{}
+
+	// Stack is the stack trace of the goroutine that panicked
+	Stack []byte
+}
+
+// NewPanicError captures the stack, it must be called from the deferred func that recovered value
+func NewPanicError(loader string, value interface{}) *PanicError {
+	return &PanicError{Loader: loader, Value: value, Stack: debug.Stack()}
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("%s: panic in fetch: %v", e.Loader, e.Value)
+}
+
+// Unwrap returns the value passed to panic if it was an error
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
@@ -0,0 +1,22 @@
+package dataloader
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckBatchLength(t *testing.T) {
+	failed := errors.New("failed")
+
+	require.NoError(t, CheckBatchLength("Loader", 2, 2, nil))
+	require.NoError(t, CheckBatchLength("Loader", 2, 2, []error{}))
+	require.NoError(t, CheckBatchLength("Loader", 2, 2, []error{nil, failed}))
+	require.NoError(t, CheckBatchLength("Loader", 2, 0, []error{failed}))
+	require.NoError(t, CheckBatchLength("Loader", 2, 0, []error{failed, failed}))
+
+	require.Equal(t, &BatchLengthError{Loader: "Loader", Keys: 2, Values: 1, Errors: 0}, CheckBatchLength("Loader", 2, 1, nil))
+	require.Equal(t, &BatchLengthError{Loader: "Loader", Keys: 2, Values: 2, Errors: 3}, CheckBatchLength("Loader", 2, 2, make([]error, 3)))
+	require.Equal(t, &BatchLengthError{Loader: "Loader", Keys: 2, Values: 0, Errors: 2}, CheckBatchLength("Loader", 2, 0, []error{nil, failed}))
+}
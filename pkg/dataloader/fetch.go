@@ -0,0 +1,45 @@
+package dataloader
+
+import "context"
+
+// MapFetch adapts a fetch func that returns its results keyed by K, in any order, for use as Config.Fetch. Keys
+// missing from the map load notFound as their error, or ErrNotFound if notFound is nil.
+func MapFetch[K comparable, V any](fetch func(keys []K) (map[K]V, error), notFound error) func(keys []K) ([]V, []error) {
+	return func(keys []K) ([]V, []error) {
+		data, err := fetch(keys)
+		return fromMap(keys, data, err, notFound)
+	}
+}
+
+// MapFetchCtx is MapFetch for use as Config.FetchCtx
+func MapFetchCtx[K comparable, V any](fetch func(ctx context.Context, keys []K) (map[K]V, error), notFound error) func(ctx context.Context, keys []K) ([]V, []error) {
+	return func(ctx context.Context, keys []K) ([]V, []error) {
+		data, err := fetch(ctx, keys)
+		return fromMap(keys, data, err, notFound)
+	}
+}
+
+// fromMap lines the values returned by a map fetch up with the keys in the batch
+func fromMap[K comparable, V any](keys []K, data map[K]V, err error, notFound error) ([]V, []error) {
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	if notFound == nil {
+		notFound = ErrNotFound
+	}
+
+	values := make([]V, len(keys))
+	var errors []error
+	for i, key := range keys {
+		value, ok := data[key]
+		if !ok {
+			if errors == nil {
+				errors = make([]error, len(keys))
+			}
+			errors[i] = notFound
+		}
+		values[i] = value
+	}
+	return values, errors
+}
@@ -0,0 +1,83 @@
+package dataloader
+
+import (
+	"context"
+	"time"
+)
+
+// Hooks are called as a loader works, to record metrics or trace batches. Every hook is optional, and they are
+// called without holding the loader's lock.
+type Hooks struct {
+	// OnLoad is called for every key loaded, including those served from the cache
+	OnLoad func(loader string)
+
+	// OnCacheHit is called for every key served from the cache, values and cached errors alike
+	OnCacheHit func(loader string)
+
+	// OnBatchStart is called just before a batch is fetched. The context it returns is passed to OnBatchEnd, and to
+	// fetch for loaders that take a context, so it can carry a span.
+	OnBatchStart func(ctx context.Context, batch BatchEvent) context.Context
+
+	// OnBatchEnd is called once a batch has been fetched, just before its results are handed to the waiters
+	OnBatchEnd func(ctx context.Context, batch BatchEvent)
+}
+
+// BatchEvent describes a batch being fetched
+type BatchEvent struct {
+	// Loader is the name of the loader
+	Loader string
+
+	// Keys is how many keys are in the batch
+	Keys int
+
+	// Wait is how long the batch spent collecting keys before it was sent
+	Wait time.Duration
+
+	// Duration is how long fetch took, only set for OnBatchEnd
+	Duration time.Duration
+
+	// Errors is how many keys failed, only set for OnBatchEnd
+	Errors int
+}
+
+// Load calls OnLoad. This and the other helpers below are used by loaders and are safe to call on nil Hooks.
+func (h *Hooks) Load(loader string) {
+	if h != nil && h.OnLoad != nil {
+		h.OnLoad(loader)
+	}
+}
+
+// CacheHit calls OnCacheHit
+func (h *Hooks) CacheHit(loader string) {
+	if h != nil && h.OnCacheHit != nil {
+		h.OnCacheHit(loader)
+	}
+}
+
+// BatchStart calls OnBatchStart, returning ctx unchanged if there is no hook
+func (h *Hooks) BatchStart(ctx context.Context, batch BatchEvent) context.Context {
+	if h == nil || h.OnBatchStart == nil {
+		return ctx
+	}
+	return h.OnBatchStart(ctx, batch)
+}
+
+// BatchEnd fills in how long fetch took and how many keys failed, then calls OnBatchEnd
+func (h *Hooks) BatchEnd(ctx context.Context, batch BatchEvent, duration time.Duration, errs []error) {
+	if h == nil || h.OnBatchEnd == nil {
+		return
+	}
+
+	batch.Duration = duration
+	if len(errs) == 1 && errs[0] != nil {
+		// a single error is returned to every key
+		batch.Errors = batch.Keys
+	} else {
+		for _, err := range errs {
+			if err != nil {
+				batch.Errors++
+			}
+		}
+	}
+	h.OnBatchEnd(ctx, batch)
+}
@@ -0,0 +1,697 @@
+// Package dataloader is the runtime behind loaders generated with dataloaden -generic. It implements the same
+// batching and caching as the generated code once, using generics, so fixes ship with a version bump instead
+// of having to regenerate every loader.
+package dataloader
+
+import (
+	"context"
+	"log/slog"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// Config captures the config to create a new Loader
+type Config[K comparable, V any] struct {
+	// Name identifies the loader in errors, generated loaders set it to their type name
+	Name string
+
+	// Fetch is a method that provides the data for the loader
+	Fetch func(keys []K) ([]V, []error)
+
+	// FetchCtx can be used instead of Fetch to receive the batch context. It carries the values of the first
+	// caller in the batch and is only cancelled once every caller waiting on the batch has given up
+	FetchCtx func(ctx context.Context, keys []K) ([]V, []error)
+
+	// NotFound is an error fetch returns for keys that don't exist, as well as ErrNotFound. Keys that aren't found
+	// are cached like values, and LoadOptional reports them as missing instead of as an error.
+	NotFound error
+
+	// Wait is how long wait before sending a batch
+	Wait time.Duration
+
+	// MaxBatch will limit the maximum number of keys to send in one batch, 0 = not limit
+	MaxBatch int
+
+	// DispatchOnThunk sends a batch as soon as one of its thunks is called, instead of waiting for Wait to pass.
+	// Load calls its thunk straight away, so queue keys with LoadThunk or LoadAll to batch them.
+	DispatchOnThunk bool
+
+	// Scheduler sends batches when its Dispatch is called, instead of once Wait has passed. Loaders sharing a
+	// scheduler have their batches sent together.
+	Scheduler *Scheduler
+
+	// Registry registers the loader under its name, and unless Scheduler is set sends its batches with the
+	// registry's scheduler.
+	Registry *Registry
+
+	// Hooks are called as the loader works, to record metrics or trace batches
+	Hooks *Hooks
+
+	// Logger logs batches slower than SlowBatchThreshold, and warns when batches keep being sent with a single key
+	Logger *slog.Logger
+
+	// SlowBatchThreshold is how long fetch can take before the batch is logged, 0 never logs slow batches
+	SlowBatchThreshold time.Duration
+
+	// Cache stores fetched values, defaults to an unbounded NewMapCache. Cached errors and keys that weren't found
+	// are only stored if it implements ErrorCache.
+	Cache Cache[K, V]
+
+	// PanicHandler is called with any panic recovered from fetch, after every waiter has been given the error.
+	// It can be used to log the panic, or to re-panic and crash like an unrecovered panic would.
+	PanicHandler func(err *PanicError)
+
+	// CacheErrors decides which errors returned by fetch are cached and replayed to later loads of the same key.
+	// nil caches no errors, CacheAllErrors caches every error. They are stored in Cache, and evicted like values.
+	CacheErrors func(err error) bool
+}
+
+// New creates a new Loader given a fetch, wait, and maxBatch
+func New[K comparable, V any](config Config[K, V]) *Loader[K, V] {
+	fetch := config.FetchCtx
+	if fetch == nil && config.Fetch != nil {
+		fetch = func(_ context.Context, keys []K) ([]V, []error) {
+			return config.Fetch(keys)
+		}
+	}
+
+	l := &Loader[K, V]{
+		name:               config.Name,
+		fetch:              fetch,
+		notFound:           config.NotFound,
+		wait:               config.Wait,
+		maxBatch:           config.MaxBatch,
+		dispatchOnThunk:    config.DispatchOnThunk,
+		scheduler:          config.Scheduler,
+		hooks:              config.Hooks,
+		logger:             config.Logger,
+		slowBatchThreshold: config.SlowBatchThreshold,
+		cache:              config.Cache,
+		panicHandler:       config.PanicHandler,
+		cacheErrors:        config.CacheErrors,
+	}
+	if config.Registry != nil {
+		if l.scheduler == nil {
+			l.scheduler = config.Registry.Scheduler()
+		}
+		config.Registry.Register(config.Name, l)
+	}
+	return l
+}
+
+// Loader batches and caches requests
+type Loader[K comparable, V any] struct {
+	// the name of the loader, used in errors
+	name string
+
+	// this method provides the data for the loader
+	fetch func(ctx context.Context, keys []K) ([]V, []error)
+
+	// the error fetch returns for keys that don't exist
+	notFound error
+
+	// how long to done before sending a batch
+	wait time.Duration
+
+	// this will limit the maximum number of keys to send in one batch, 0 = no limit
+	maxBatch int
+
+	// send the batch as soon as one of its thunks is called
+	dispatchOnThunk bool
+
+	// sends batches in place of the timer, if set
+	scheduler *Scheduler
+
+	// called as the loader works
+	hooks *Hooks
+
+	// logs slow batches and loaders that aren't batching
+	logger *slog.Logger
+
+	// how long fetch can take before the batch is logged
+	slowBatchThreshold time.Duration
+
+	// called with any panic recovered from fetch
+	panicHandler func(err *PanicError)
+
+	// decides which fetch errors are cached
+	cacheErrors func(err error) bool
+
+	// INTERNAL
+
+	// the cache, lazily created if one wasn't configured
+	cache Cache[K, V]
+
+	// counts the work done by the loader
+	stats Stats
+
+	// how many batches in a row have been sent with a single key, only counted when there is a logger
+	singleKeyBatches int
+
+	// the current batch. keys will continue to be collected until timeout is hit,
+	// then everything will be sent to the fetch method and out to the listeners
+	batch *batch[K, V]
+
+	// batches that have been started but haven't cached their results yet
+	inflight map[*batch[K, V]]bool
+
+	// mutex to prevent races
+	mu sync.Mutex
+}
+
+type batch[K comparable, V any] struct {
+	keys    []K
+	index   map[K]int
+	data    []V
+	error   []error
+	closing bool
+	done    chan struct{}
+	timer   *time.Timer
+	start   time.Time
+
+	// the context passed to fetch, detached from the first caller and cancelled once every waiter has given up
+	ctx     context.Context
+	cancel  context.CancelFunc
+	waiters int
+
+	// keys set or cleared since the batch started, their fetched results are stale and aren't cached
+	written map[K]bool
+	cleared bool
+}
+
+// Load a value by key, batching and caching will be applied automatically
+func (l *Loader[K, V]) Load(key K) (V, error) {
+	return l.LoadThunk(key)()
+}
+
+// LoadCtx loads a value by key, returning ctx.Err() as soon as ctx is done
+func (l *Loader[K, V]) LoadCtx(ctx context.Context, key K) (V, error) {
+	return l.LoadThunkCtx(ctx, key)()
+}
+
+// LoadOptional loads a value by key, returning false instead of an error if it doesn't exist
+func (l *Loader[K, V]) LoadOptional(key K) (V, bool, error) {
+	return l.optional(l.Load(key))
+}
+
+// LoadOptionalCtx loads a value by key, returning false instead of an error if it doesn't exist
+func (l *Loader[K, V]) LoadOptionalCtx(ctx context.Context, key K) (V, bool, error) {
+	return l.optional(l.LoadCtx(ctx, key))
+}
+
+// optional turns not found errors into a missing value
+func (l *Loader[K, V]) optional(value V, err error) (V, bool, error) {
+	if err == nil {
+		return value, true, nil
+	}
+
+	var zero V
+	if IsNotFound(err, l.notFound) {
+		return zero, false, nil
+	}
+	return zero, false, err
+}
+
+// LoadThunk returns a function that when called will block waiting for a value.
+// This method should be used if you want one goroutine to make requests to many
+// different data loaders without blocking until the thunk is called.
+func (l *Loader[K, V]) LoadThunk(key K) func() (V, error) {
+	return l.LoadThunkCtx(context.Background(), key)
+}
+
+// LoadThunkCtx returns a function that when called will block waiting for a value, or until ctx is done.
+// The batch is fetched with a context carrying the values of the first caller to join it, which is only
+// cancelled once the context of every caller waiting on the batch has been cancelled.
+func (l *Loader[K, V]) LoadThunkCtx(ctx context.Context, key K) func() (V, error) {
+	l.hooks.Load(l.name)
+	l.mu.Lock()
+	l.stats.Loads++
+	if it, ok := l.unsafeGet(key); ok {
+		l.stats.Hits++
+		l.mu.Unlock()
+		l.hooks.CacheHit(l.name)
+		return func() (V, error) {
+			return it, nil
+		}
+	}
+	if err, ok := CacheGetError(l.cache, key); ok {
+		l.stats.Hits++
+		l.mu.Unlock()
+		l.hooks.CacheHit(l.name)
+		return func() (V, error) {
+			var zero V
+			return zero, err
+		}
+	}
+	if l.batch == nil {
+		l.batch = &batch[K, V]{index: map[K]int{}, done: make(chan struct{})}
+		l.batch.ctx, l.batch.cancel = context.WithCancel(context.WithoutCancel(ctx))
+		if l.inflight == nil {
+			l.inflight = map[*batch[K, V]]bool{}
+		}
+		l.inflight[l.batch] = true
+	}
+	batch := l.batch
+	pos := batch.keyIndex(l, key)
+	batch.waiters++
+	l.mu.Unlock()
+
+	stop := context.AfterFunc(ctx, func() {
+		l.mu.Lock()
+		batch.abandon(l)
+		l.mu.Unlock()
+	})
+
+	return func() (V, error) {
+		if l.dispatchOnThunk {
+			l.mu.Lock()
+			batch.dispatch(l)
+			l.mu.Unlock()
+		}
+
+		select {
+		case <-batch.done:
+			stop()
+		case <-ctx.Done():
+			var zero V
+			return zero, ctx.Err()
+		}
+
+		return batch.result(pos)
+	}
+}
+
+// LoadAll fetches many keys at once. It will be broken into appropriate sized
+// sub batches depending on how the loader is configured
+func (l *Loader[K, V]) LoadAll(keys []K) ([]V, []error) {
+	return l.LoadAllThunk(keys)()
+}
+
+// LoadAllCtx fetches many keys at once, any keys still pending when ctx is done will return ctx.Err()
+func (l *Loader[K, V]) LoadAllCtx(ctx context.Context, keys []K) ([]V, []error) {
+	return l.LoadAllThunkCtx(ctx, keys)()
+}
+
+// LoadAllThunk returns a function that when called will block waiting for the values.
+// This method should be used if you want one goroutine to make requests to many
+// different data loaders without blocking until the thunk is called.
+func (l *Loader[K, V]) LoadAllThunk(keys []K) func() ([]V, []error) {
+	return l.LoadAllThunkCtx(context.Background(), keys)
+}
+
+// LoadAllThunkCtx returns a function that when called will block waiting for the values, or until ctx is done.
+func (l *Loader[K, V]) LoadAllThunkCtx(ctx context.Context, keys []K) func() ([]V, []error) {
+	results := make([]func() (V, error), len(keys))
+	for i, key := range keys {
+		results[i] = l.LoadThunkCtx(ctx, key)
+	}
+	return func() ([]V, []error) {
+		values := make([]V, len(keys))
+		errors := make([]error, len(keys))
+		for i, thunk := range results {
+			values[i], errors[i] = thunk()
+		}
+		return values, errors
+	}
+}
+
+// Prime the cache with the provided key and value. If the key already has a value, no change is made
+// and false is returned. Priming replaces any cached error for the key.
+// (To forcefully prime the cache, use Set.)
+func (l *Loader[K, V]) Prime(key K, value V) bool {
+	l.mu.Lock()
+	var found bool
+	if _, found = l.unsafeGet(key); !found {
+		l.unsafePrime(key, value)
+	}
+	l.mu.Unlock()
+	return !found
+}
+
+// PrimeMany primes the cache with every value whose key doesn't already have a value, returning how many were
+// primed
+func (l *Loader[K, V]) PrimeMany(values map[K]V) int {
+	primed := 0
+	l.mu.Lock()
+	for key, value := range values {
+		if _, found := l.unsafeGet(key); !found {
+			l.unsafePrime(key, value)
+			primed++
+		}
+	}
+	l.mu.Unlock()
+	return primed
+}
+
+// Set the value for key in the cache, replacing any value or error already cached for it
+func (l *Loader[K, V]) Set(key K, value V) {
+	l.mu.Lock()
+	l.unsafePrime(key, value)
+	l.mu.Unlock()
+}
+
+// SetMany sets every value in the cache at once, replacing any values or errors already cached for their keys
+func (l *Loader[K, V]) SetMany(values map[K]V) {
+	l.mu.Lock()
+	for key, value := range values {
+		l.unsafePrime(key, value)
+	}
+	l.mu.Unlock()
+}
+
+// Clear the value or error at key from the cache, if it exists
+func (l *Loader[K, V]) Clear(key K) {
+	l.mu.Lock()
+	l.unsafeClear(key)
+	l.mu.Unlock()
+}
+
+// ClearMany clears the values and errors at every key from the cache at once
+func (l *Loader[K, V]) ClearMany(keys []K) {
+	l.mu.Lock()
+	for _, key := range keys {
+		l.unsafeClear(key)
+	}
+	l.mu.Unlock()
+}
+
+// ClearAll clears every value and error from the cache, a cache shared with other loaders is cleared for all of them
+func (l *Loader[K, V]) ClearAll() {
+	l.mu.Lock()
+	if l.cache != nil {
+		l.cache.Clear()
+	}
+	for b := range l.inflight {
+		b.cleared = true
+	}
+	l.mu.Unlock()
+}
+
+// Peek returns the cached value for key, without loading it if it isn't cached
+func (l *Loader[K, V]) Peek(key K) (V, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.unsafeGet(key)
+}
+
+// Has reports whether a value is cached for key
+func (l *Loader[K, V]) Has(key K) bool {
+	_, ok := l.Peek(key)
+	return ok
+}
+
+// Len is the number of cached values, caches that don't implement Ranger are always empty
+func (l *Loader[K, V]) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return CacheLen(l.cache)
+}
+
+// Snapshot copies the cached values, caches that don't implement Ranger are always empty
+func (l *Loader[K, V]) Snapshot() map[K]V {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return CacheSnapshot(l.cache)
+}
+
+// Flush sends the current batch straight away, instead of waiting for it to fill up or for wait to pass
+func (l *Loader[K, V]) Flush() {
+	l.mu.Lock()
+	if l.batch != nil {
+		l.batch.dispatch(l)
+	}
+	l.mu.Unlock()
+}
+
+// logBatch logs batches slower than slowBatchThreshold, and warns when batches keep being sent with a single key
+func (l *Loader[K, V]) logBatch(keys []K, duration time.Duration) {
+	if l.logger == nil {
+		return
+	}
+
+	if l.slowBatchThreshold > 0 && duration >= l.slowBatchThreshold {
+		l.logger.Warn("slow dataloader batch", "loader", l.name, "keys", len(keys), "sample", KeySample(keys), "duration", duration)
+	}
+
+	l.mu.Lock()
+	if len(keys) == 1 {
+		l.singleKeyBatches++
+	} else {
+		l.singleKeyBatches = 0
+	}
+	singleKeyBatches := l.singleKeyBatches
+	notBatching := singleKeyBatches > 0 && singleKeyBatches%SingleKeyBatchWarning == 0
+	l.mu.Unlock()
+
+	if notBatching {
+		l.logger.Warn("dataloader is not batching", "loader", l.name, "singleKeyBatches", singleKeyBatches, "wait", l.wait)
+	}
+}
+
+// Stats counts the keys loaded and fetched by the loader
+func (l *Loader[K, V]) Stats() Stats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.stats
+}
+
+func (l *Loader[K, V]) unsafeGet(key K) (V, bool) {
+	if l.cache == nil {
+		var zero V
+		return zero, false
+	}
+	return l.cache.Get(key)
+}
+
+func (l *Loader[K, V]) unsafeSet(key K, value V) {
+	if l.cache == nil {
+		l.cache = NewMapCache[K, V]()
+	}
+	l.cache.Set(key, value)
+}
+
+// unsafePrime stores a copy of value, its easy to pass a pointer in from a loop var and end up with the whole
+// cache pointing to the same value.
+func (l *Loader[K, V]) unsafePrime(key K, value V) {
+	l.unsafeWritten(key)
+	l.unsafeSet(key, shallowCopy(value))
+}
+
+func (l *Loader[K, V]) unsafeClear(key K) {
+	l.unsafeWritten(key)
+	if l.cache != nil {
+		l.cache.Delete(key)
+	}
+}
+
+// unsafeWritten stops batches that are already in flight from caching a stale result over a write to key
+func (l *Loader[K, V]) unsafeWritten(key K) {
+	for b := range l.inflight {
+		if b.written == nil {
+			b.written = map[K]bool{}
+		}
+		b.written[key] = true
+	}
+}
+
+func (l *Loader[K, V]) unsafeSetError(key K, err error) {
+	if l.cache == nil {
+		l.cache = NewMapCache[K, V]()
+	}
+	CacheSetError(l.cache, key, err)
+}
+
+// keyIndex will return the location of the key in the batch, if its not found
+// it will add the key to the batch
+func (b *batch[K, V]) keyIndex(l *Loader[K, V], key K) int {
+	if i, ok := b.index[key]; ok {
+		return i
+	}
+
+	pos := len(b.keys)
+	b.keys = append(b.keys, key)
+	b.index[key] = pos
+	if pos == 0 {
+		b.startTimer(l)
+	}
+
+	if l.maxBatch != 0 && pos >= l.maxBatch-1 {
+		b.dispatch(l)
+	}
+
+	return pos
+}
+
+// startTimer schedules the batch to be sent once wait has passed, or by the scheduler if there is one.
+// The timer is stopped if the batch is closed early.
+func (b *batch[K, V]) startTimer(l *Loader[K, V]) {
+	b.start = time.Now()
+	if l.scheduler != nil {
+		l.scheduler.Schedule(func() {
+			l.mu.Lock()
+			b.dispatch(l)
+			l.mu.Unlock()
+		})
+		return
+	}
+
+	b.timer = time.AfterFunc(l.wait, func() {
+		b.timeout(l)
+	})
+}
+
+func (b *batch[K, V]) timeout(l *Loader[K, V]) {
+	l.mu.Lock()
+
+	// we must have hit a batch limit or been flushed and are already finalizing this batch
+	if b.closing {
+		l.mu.Unlock()
+		return
+	}
+
+	b.closing = true
+	l.batch = nil
+	l.mu.Unlock()
+
+	b.end(l)
+}
+
+// dispatch stops the batch collecting keys and sends it straight away, it must be called while holding the lock
+func (b *batch[K, V]) dispatch(l *Loader[K, V]) {
+	if b.closing {
+		return
+	}
+
+	b.closing = true
+	if b.timer != nil {
+		b.timer.Stop()
+	}
+	if l.batch == b {
+		l.batch = nil
+	}
+	go b.end(l)
+}
+
+func (b *batch[K, V]) end(l *Loader[K, V]) {
+	l.mu.Lock()
+	l.stats.Batches++
+	l.stats.Keys += len(b.keys)
+	l.mu.Unlock()
+
+	event := BatchEvent{Loader: l.name, Keys: len(b.keys), Wait: time.Since(b.start)}
+	b.ctx = l.hooks.BatchStart(b.ctx, event)
+	start := time.Now()
+
+	panicErr := b.fetch(l)
+	duration := time.Since(start)
+	l.hooks.BatchEnd(b.ctx, event, duration, b.error)
+	l.logBatch(b.keys, duration)
+	l.mu.Lock()
+	b.cache(l)
+	l.mu.Unlock()
+	b.cancel()
+	close(b.done)
+
+	if panicErr != nil && l.panicHandler != nil {
+		l.panicHandler(panicErr)
+	}
+}
+
+// cache stores the results of the batch, unless every waiter gave up on it. Keys written since the batch started
+// keep what was written.
+func (b *batch[K, V]) cache(l *Loader[K, V]) {
+	delete(l.inflight, b)
+	if b.cleared || b.ctx.Err() != nil {
+		return
+	}
+
+	for pos, key := range b.keys {
+		if b.written[key] {
+			continue
+		}
+		data, err := b.result(pos)
+		if err == nil {
+			l.unsafeSet(key, data)
+		} else if IsNotFound(err, l.notFound) || (l.cacheErrors != nil && l.cacheErrors(err)) {
+			l.unsafeSetError(key, err)
+		}
+	}
+}
+
+// result is the value and error fetched for the key at pos
+func (b *batch[K, V]) result(pos int) (V, error) {
+	var data V
+	if pos < len(b.data) {
+		data = b.data[pos]
+	}
+
+	var err error
+	// its convenient to be able to return a single error for everything
+	if len(b.error) == 1 {
+		err = b.error[0]
+	} else if len(b.error) > 0 {
+		err = b.error[pos]
+	}
+	return data, err
+}
+
+// fetch calls the fetch func for the batch, any panic is recovered and returned to every waiter
+func (b *batch[K, V]) fetch(l *Loader[K, V]) (panicErr *PanicError) {
+	defer func() {
+		if r := recover(); r != nil {
+			panicErr = NewPanicError(l.name, r)
+			b.data = nil
+			b.error = []error{panicErr}
+		}
+	}()
+
+	b.data, b.error = l.fetch(b.ctx, b.keys)
+	if err := CheckBatchLength(l.name, len(b.keys), len(b.data), b.error); err != nil {
+		b.data = nil
+		b.error = []error{err}
+	}
+	return nil
+}
+
+// abandon is called when the context of a waiter is done. Once every waiter has given up a batch that is still
+// collecting keys is dropped without being fetched, and a batch that is already being fetched has its context cancelled.
+func (b *batch[K, V]) abandon(l *Loader[K, V]) {
+	b.waiters--
+	if b.waiters > 0 {
+		return
+	}
+
+	if l.batch == b {
+		b.closing = true
+		if b.timer != nil {
+			b.timer.Stop()
+		}
+		l.batch = nil
+		delete(l.inflight, b)
+	}
+	b.cancel()
+}
+
+// shallowCopy copies the value behind pointers and the backing array of slices, matching what the generated
+// Prime does for pointer and slice value types.
+func shallowCopy[V any](value V) V {
+	rv := reflect.ValueOf(&value).Elem()
+	switch rv.Kind() {
+	case reflect.Ptr:
+		if rv.IsNil() {
+			return value
+		}
+		cpy := reflect.New(rv.Type().Elem())
+		cpy.Elem().Set(rv.Elem())
+		rv.Set(cpy)
+	case reflect.Slice:
+		if rv.IsNil() {
+			return value
+		}
+		cpy := reflect.MakeSlice(rv.Type(), rv.Len(), rv.Len())
+		reflect.Copy(cpy, rv)
+		rv.Set(cpy)
+	}
+	return value
+}
@@ -0,0 +1,366 @@
+package dataloader
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type ctxKey string
+
+func TestLoaderContext(t *testing.T) {
+	var fetches [][]int
+	var mu sync.Mutex
+
+	dl := New(Config[int, string]{
+		Wait:     10 * time.Millisecond,
+		MaxBatch: 5,
+		FetchCtx: func(ctx context.Context, keys []int) ([]string, []error) {
+			mu.Lock()
+			fetches = append(fetches, keys)
+			mu.Unlock()
+
+			values := make([]string, len(keys))
+			for i := range keys {
+				values[i], _ = ctx.Value(ctxKey("name")).(string)
+			}
+			return values, nil
+		},
+	})
+
+	t.Run("values from the first caller are passed to fetch", func(t *testing.T) {
+		v, err := dl.LoadCtx(context.WithValue(context.Background(), ctxKey("name"), "first"), 1)
+		require.NoError(t, err)
+		require.Equal(t, "first", v)
+	})
+
+	t.Run("batches are dropped once every waiter gives up", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		thunk := dl.LoadAllThunkCtx(ctx, []int{2, 3})
+		cancel()
+
+		_, errs := thunk()
+		require.Equal(t, context.Canceled, errs[0])
+		require.Equal(t, context.Canceled, errs[1])
+
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		require.Len(t, fetches, 1)
+		mu.Unlock()
+	})
+}
+
+func TestLoaderPrimeCopies(t *testing.T) {
+	dl := New(Config[int, []string]{
+		Fetch: func(keys []int) ([][]string, []error) {
+			return make([][]string, len(keys)), nil
+		},
+	})
+
+	value := []string{"a"}
+	require.True(t, dl.Prime(1, value))
+	require.False(t, dl.Prime(1, []string{"b"}))
+	value[0] = "changed"
+
+	v, err := dl.Load(1)
+	require.NoError(t, err)
+	require.Equal(t, []string{"a"}, v)
+}
+
+func TestMapFetch(t *testing.T) {
+	notFound := errors.New("not found")
+	dl := New(Config[int, string]{
+		Fetch: MapFetch(func(keys []int) (map[int]string, error) {
+			return map[int]string{3: "three", 1: "one"}, nil
+		}, notFound),
+	})
+
+	values, errs := dl.LoadAll([]int{1, 2, 3})
+	require.Equal(t, []string{"one", "", "three"}, values)
+	require.Equal(t, []error{nil, notFound, nil}, errs)
+
+	dl = New(Config[int, string]{
+		Fetch: MapFetch(func(keys []int) (map[int]string, error) {
+			return map[int]string{1: "one"}, nil
+		}, nil),
+	})
+	_, ok, err := dl.LoadOptional(2)
+	require.NoError(t, err)
+	require.False(t, ok, "missing keys default to ErrNotFound")
+}
+
+func TestLoaderPanic(t *testing.T) {
+	failed := errors.New("failed")
+	dl := New(Config[int, string]{
+		Name: "IntLoader",
+		Fetch: func(keys []int) ([]string, []error) {
+			panic(failed)
+		},
+	})
+
+	_, err := dl.Load(1)
+	require.ErrorIs(t, err, failed)
+	require.EqualError(t, err, "IntLoader: panic in fetch: failed")
+}
+
+func TestLoaderCacheAllErrors(t *testing.T) {
+	failed := errors.New("failed")
+	var fetches int
+	dl := New(Config[int, string]{
+		CacheErrors: CacheAllErrors,
+		Fetch: func(keys []int) ([]string, []error) {
+			fetches++
+			return nil, []error{failed}
+		},
+	})
+
+	_, err := dl.Load(1)
+	require.Equal(t, failed, err)
+	_, err = dl.Load(1)
+	require.Equal(t, failed, err)
+	require.Equal(t, 1, fetches)
+
+	dl.Clear(1)
+	_, err = dl.Load(1)
+	require.Equal(t, failed, err)
+	require.Equal(t, 2, fetches)
+}
+
+func TestLoaderEmptyErrors(t *testing.T) {
+	dl := New(Config[int, string]{
+		Fetch: func(keys []int) ([]string, []error) {
+			return make([]string, len(keys)), []error{}
+		},
+	})
+
+	_, errs := dl.LoadAll([]int{1, 2})
+	require.Equal(t, []error{nil, nil}, errs, "an empty error slice means there were no errors")
+}
+
+func TestLoaderFullBatchStopsTimer(t *testing.T) {
+	dl := New(Config[int, string]{
+		Wait:     time.Hour,
+		MaxBatch: 2,
+		Fetch: func(keys []int) ([]string, []error) {
+			return make([]string, len(keys)), nil
+		},
+	})
+
+	before := runtime.NumGoroutine()
+	for i := 0; i < 100; i += 2 {
+		dl.LoadAll([]int{i, i + 1})
+	}
+
+	// give the goroutines sending each batch a moment to exit
+	for i := 0; i < 100 && runtime.NumGoroutine() > before; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.LessOrEqual(t, runtime.NumGoroutine(), before, "full batches should not leave anything waiting on the timer")
+}
+
+func TestLoaderFlush(t *testing.T) {
+	var fetches [][]int
+	fetch := func(keys []int) ([]string, []error) {
+		fetches = append(fetches, keys)
+		return make([]string, len(keys)), nil
+	}
+
+	dl := New(Config[int, string]{Wait: time.Hour, Fetch: fetch})
+	thunk := dl.LoadAllThunk([]int{1, 2})
+	dl.Flush()
+	_, errs := thunk()
+	require.Equal(t, []error{nil, nil}, errs)
+	require.Equal(t, [][]int{{1, 2}}, fetches)
+
+	dl = New(Config[int, string]{Wait: time.Hour, Fetch: fetch, DispatchOnThunk: true})
+	_, errs = dl.LoadAll([]int{3, 4})
+	require.Equal(t, []error{nil, nil}, errs)
+	require.Equal(t, []int{3, 4}, fetches[1])
+}
+
+func TestLoaderLogger(t *testing.T) {
+	var buf bytes.Buffer
+	dl := New(Config[int, string]{
+		Name:               "NumberLoader",
+		Wait:               time.Millisecond,
+		Logger:             slog.New(slog.NewTextHandler(&buf, nil)),
+		SlowBatchThreshold: time.Nanosecond,
+		Fetch: func(keys []int) ([]string, []error) {
+			time.Sleep(time.Millisecond)
+			return make([]string, len(keys)), nil
+		},
+	})
+
+	dl.LoadAll([]int{1, 2, 3, 4, 5, 6, 7})
+	require.Contains(t, buf.String(), `loader=NumberLoader keys=7 sample="[1 2 3 4 5]"`)
+	require.Equal(t, []int{1}, KeySample([]int{1}))
+}
+
+func TestResultFetch(t *testing.T) {
+	notFound := errors.New("not found")
+	dl := New(Config[int, string]{
+		Fetch: ResultFetch(func(keys []int) []Result[string] {
+			results := make([]Result[string], len(keys))
+			for i, key := range keys {
+				if key == 2 {
+					results[i].Err = notFound
+				} else {
+					results[i].Value = strconv.Itoa(key)
+				}
+			}
+			return results
+		}),
+	})
+
+	results := Results(dl.LoadAll([]int{1, 2, 3}))
+	require.Equal(t, []Result[string]{{Value: "1"}, {Err: notFound}, {Value: "3"}}, results)
+}
+
+func TestLoaderNotFound(t *testing.T) {
+	noSuchNumber := errors.New("no such number")
+	fetches := 0
+	dl := New(Config[int, string]{
+		NotFound: noSuchNumber,
+		Fetch: func(keys []int) ([]string, []error) {
+			fetches++
+			return make([]string, len(keys)), []error{noSuchNumber}
+		},
+	})
+
+	value, ok, err := dl.LoadOptional(1)
+	require.NoError(t, err)
+	require.False(t, ok)
+	require.Equal(t, "", value)
+
+	_, err = dl.Load(1)
+	require.Equal(t, noSuchNumber, err)
+	require.Equal(t, 1, fetches)
+	require.True(t, IsNotFound(fmt.Errorf("wrapped: %w", ErrNotFound), nil))
+}
+
+func TestLoaderNotFoundExpires(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache := NewTTLCache[int, string](time.Minute).(*ttlCache[int, string])
+	cache.now = func() time.Time { return now }
+
+	fetches := 0
+	dl := New(Config[int, string]{
+		Cache: cache,
+		Fetch: func(keys []int) ([]string, []error) {
+			fetches++
+			return make([]string, len(keys)), []error{ErrNotFound}
+		},
+	})
+
+	_, err := dl.Load(1)
+	require.Equal(t, ErrNotFound, err)
+	_, err = dl.Load(1)
+	require.Equal(t, ErrNotFound, err)
+	require.Equal(t, 1, fetches, "keys that weren't found are cached")
+	require.Equal(t, 0, dl.Len(), "keys that weren't found aren't values")
+
+	now = now.Add(time.Minute)
+	_, err = dl.Load(1)
+	require.Equal(t, ErrNotFound, err)
+	require.Equal(t, 2, fetches, "keys that weren't found expire with the cache's ttl")
+
+	dl.ClearAll()
+	_, err = dl.Load(1)
+	require.Equal(t, ErrNotFound, err)
+	require.Equal(t, 3, fetches, "keys that weren't found are cleared with the cache")
+}
+
+func TestLoaderPeek(t *testing.T) {
+	dl := New(Config[int, string]{
+		Fetch: func(keys []int) ([]string, []error) {
+			values := make([]string, len(keys))
+			for i, key := range keys {
+				values[i] = strconv.Itoa(key)
+			}
+			return values, nil
+		},
+	})
+
+	_, ok := dl.Peek(1)
+	require.False(t, ok)
+	require.Equal(t, 0, dl.Len())
+
+	dl.Load(1)
+	value, ok := dl.Peek(1)
+	require.True(t, ok)
+	require.Equal(t, "1", value)
+	require.True(t, dl.Has(1))
+	require.False(t, dl.Has(2))
+	require.Equal(t, 1, dl.Len())
+	require.Equal(t, map[int]string{1: "1"}, dl.Snapshot())
+}
+
+func TestLoaderBulkCache(t *testing.T) {
+	fetches := 0
+	dl := New(Config[int, string]{
+		Fetch: func(keys []int) ([]string, []error) {
+			fetches++
+			values := make([]string, len(keys))
+			for i, key := range keys {
+				values[i] = strconv.Itoa(key)
+			}
+			return values, nil
+		},
+	})
+
+	dl.LoadAll([]int{1, 2, 3})
+	dl.Set(1, "one")
+	require.Equal(t, 1, dl.PrimeMany(map[int]string{1: "uno", 4: "four"}))
+	dl.SetMany(map[int]string{2: "two", 3: "three"})
+	require.Equal(t, map[int]string{1: "one", 2: "two", 3: "three", 4: "four"}, dl.Snapshot())
+
+	dl.ClearMany([]int{1, 2})
+	require.Equal(t, map[int]string{3: "three", 4: "four"}, dl.Snapshot())
+
+	dl.ClearAll()
+	require.Equal(t, 0, dl.Len())
+	require.Equal(t, 1, fetches)
+}
+
+func TestLoaderWritesDuringFetch(t *testing.T) {
+	scheduler := NewScheduler()
+	dl := New(Config[int, string]{
+		Scheduler: scheduler,
+		Fetch: func(keys []int) ([]string, []error) {
+			values := make([]string, len(keys))
+			for i := range keys {
+				values[i] = "stale"
+			}
+			return values, nil
+		},
+	})
+
+	thunk := dl.LoadAllThunk([]int{1, 2, 3, 4})
+	dl.Set(1, "fresh")
+	dl.Clear(2)
+	scheduler.Dispatch()
+	values, _ := thunk()
+	require.Equal(t, []string{"stale", "stale", "stale", "stale"}, values, "waiters still get what was fetched")
+	require.Equal(t, map[int]string{1: "fresh", 3: "stale", 4: "stale"}, dl.Snapshot(), "writes made during a fetch win")
+
+	thunk = dl.LoadAllThunk([]int{5, 6})
+	dl.ClearAll()
+	scheduler.Dispatch()
+	thunk()
+	require.Equal(t, 0, dl.Len(), "batches started before ClearAll aren't cached")
+
+	thunk = dl.LoadAllThunk([]int{1})
+	scheduler.Dispatch()
+	thunk()
+	value, _ := dl.Peek(1)
+	require.Equal(t, "stale", value, "later batches are cached as usual")
+}
@@ -0,0 +1,16 @@
+package dataloader
+
+// SingleKeyBatchWarning is how many batches in a row with a single key a loader sends before it logs that it isn't
+// batching, it warns again every time the count is reached
+const SingleKeyBatchWarning = 10
+
+// keySampleSize is how many keys are logged with a slow batch
+const keySampleSize = 5
+
+// KeySample returns the first few keys in a batch, for logging
+func KeySample[K any](keys []K) []K {
+	if len(keys) > keySampleSize {
+		return keys[:keySampleSize]
+	}
+	return keys
+}
@@ -0,0 +1,116 @@
+package dataloader
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Stats counts the work done by a loader
+type Stats struct {
+	// Loads is how many keys have been loaded, including those served from the cache
+	Loads int
+
+	// Hits is how many loads were served from the cache, values and cached errors alike
+	Hits int
+
+	// Batches is how many batches have been fetched
+	Batches int
+
+	// Keys is how many keys have been fetched, across every batch
+	Keys int
+}
+
+// Add returns the sum of both stats
+func (s Stats) Add(o Stats) Stats {
+	return Stats{
+		Loads:   s.Loads + o.Loads,
+		Hits:    s.Hits + o.Hits,
+		Batches: s.Batches + o.Batches,
+		Keys:    s.Keys + o.Keys,
+	}
+}
+
+// Dispatcher is implemented by every loader, generated or generic, so a Registry can manage them together
+type Dispatcher interface {
+	// Flush sends the current batch straight away
+	Flush()
+
+	// Stats counts the work done by the loader
+	Stats() Stats
+}
+
+// Registry holds the loaders for a single request. Loaders created with the registry in their config register
+// themselves by name, and share the registry's Scheduler so their batches are sent together.
+type Registry struct {
+	scheduler *Scheduler
+	loaders   map[string]Dispatcher
+	mu        sync.Mutex
+}
+
+// NewRegistry creates an empty Registry. Batches started by its loaders are sent together wait after the first of
+// them is started, or when Flush is called. A wait of 0 only sends them when Flush is called.
+func NewRegistry(wait time.Duration) *Registry {
+	return &Registry{
+		scheduler: NewTimedScheduler(wait),
+		loaders:   map[string]Dispatcher{},
+	}
+}
+
+// Scheduler sends the batches of every loader in the registry that doesn't have a scheduler of its own
+func (r *Registry) Scheduler() *Scheduler {
+	return r.scheduler
+}
+
+// Register adds loader to the registry under name, returning the name it was registered as. A request can have many
+// loaders of the same type, eg one per tenant, so if name is taken a number is added to it: UserLoader#2, UserLoader#3.
+func (r *Registry) Register(name string, loader Dispatcher) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	registered := name
+	for i := 2; r.loaders[registered] != nil; i++ {
+		registered = fmt.Sprintf("%s#%d", name, i)
+	}
+	r.loaders[registered] = loader
+	return registered
+}
+
+// Get returns the loader registered with name, or nil if there isn't one
+func (r *Registry) Get(name string) Dispatcher {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.loaders[name]
+}
+
+// Names lists the names of every registered loader, in order
+func (r *Registry) Names() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	names := make([]string, 0, len(r.loaders))
+	for name := range r.loaders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Flush sends the pending batch of every registered loader straight away
+func (r *Registry) Flush() {
+	r.scheduler.Dispatch()
+	for _, name := range r.Names() {
+		r.Get(name).Flush()
+	}
+}
+
+// Stats adds up the stats of every registered loader
+func (r *Registry) Stats() Stats {
+	var total Stats
+	for _, name := range r.Names() {
+		total = total.Add(r.Get(name).Stats())
+	}
+	return total
+}
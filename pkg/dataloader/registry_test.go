@@ -0,0 +1,91 @@
+package dataloader
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry(0)
+	ints := New(Config[int, string]{
+		Name:     "IntLoader",
+		Registry: r,
+		Fetch: func(keys []int) ([]string, []error) {
+			values := make([]string, len(keys))
+			for i, key := range keys {
+				values[i] = strconv.Itoa(key)
+			}
+			return values, nil
+		},
+	})
+	strs := New(Config[string, string]{
+		Name:     "StringLoader",
+		Registry: r,
+		Fetch: func(keys []string) ([]string, []error) {
+			return keys, nil
+		},
+	})
+
+	t.Run("loaders are registered by name", func(t *testing.T) {
+		require.Equal(t, []string{"IntLoader", "StringLoader"}, r.Names())
+		require.Equal(t, ints, r.Get("IntLoader"))
+		require.Nil(t, r.Get("Missing"))
+	})
+
+	t.Run("loaders with the same name are numbered", func(t *testing.T) {
+		r := NewRegistry(0)
+		first := New(Config[int, string]{Name: "IntLoader", Registry: r})
+		second := New(Config[int, string]{Name: "IntLoader", Registry: r})
+		require.Equal(t, "IntLoader#3", r.Register("IntLoader", first))
+		require.Equal(t, []string{"IntLoader", "IntLoader#2", "IntLoader#3"}, r.Names())
+		require.Same(t, first, r.Get("IntLoader"))
+		require.Same(t, second, r.Get("IntLoader#2"))
+	})
+
+	t.Run("flush sends every batch", func(t *testing.T) {
+		intThunk := ints.LoadAllThunk([]int{1, 2})
+		strThunk := strs.LoadThunk("a")
+		r.Flush()
+
+		values, _ := intThunk()
+		require.Equal(t, []string{"1", "2"}, values)
+		v, _ := strThunk()
+		require.Equal(t, "a", v)
+	})
+
+	t.Run("stats are added up", func(t *testing.T) {
+		ints.Load(1)
+		require.Equal(t, Stats{Loads: 3, Hits: 1, Batches: 1, Keys: 2}, ints.Stats())
+		require.Equal(t, Stats{Loads: 4, Hits: 1, Batches: 2, Keys: 3}, r.Stats())
+	})
+}
+
+func TestRegistryWait(t *testing.T) {
+	r := NewRegistry(5 * time.Millisecond)
+	var fetched []string
+	var mu sync.Mutex
+	fetch := func(name string) func(keys []int) ([]int, []error) {
+		return func(keys []int) ([]int, []error) {
+			mu.Lock()
+			fetched = append(fetched, name)
+			mu.Unlock()
+			return keys, nil
+		}
+	}
+
+	// each loader would wait an hour on its own, the registry sends them both once its wait has passed
+	a := New(Config[int, int]{Name: "A", Registry: r, Wait: time.Hour, Fetch: fetch("A")})
+	b := New(Config[int, int]{Name: "B", Registry: r, Wait: time.Hour, Fetch: fetch("B")})
+
+	thunkA := a.LoadThunk(1)
+	thunkB := b.LoadThunk(1)
+	_, err := thunkA()
+	require.NoError(t, err)
+	_, err = thunkB()
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"A", "B"}, fetched)
+}
@@ -0,0 +1,53 @@
+package dataloader
+
+import "context"
+
+// Result is the value or error loaded for a single key
+type Result[V any] struct {
+	Value V
+	Err   error
+}
+
+// ResultFetch adapts a fetch func that returns a Result for each key, in the same order as the keys, for use as
+// Config.Fetch
+func ResultFetch[K comparable, V any](fetch func(keys []K) []Result[V]) func(keys []K) ([]V, []error) {
+	return func(keys []K) ([]V, []error) {
+		return SplitResults(fetch(keys))
+	}
+}
+
+// ResultFetchCtx is ResultFetch for use as Config.FetchCtx
+func ResultFetchCtx[K comparable, V any](fetch func(ctx context.Context, keys []K) []Result[V]) func(ctx context.Context, keys []K) ([]V, []error) {
+	return func(ctx context.Context, keys []K) ([]V, []error) {
+		return SplitResults(fetch(ctx, keys))
+	}
+}
+
+// SplitResults splits results into the parallel values and errors returned by a fetch, the errors are nil if none
+// of the results failed
+func SplitResults[V any](results []Result[V]) ([]V, []error) {
+	values := make([]V, len(results))
+	var errors []error
+	for i, result := range results {
+		values[i] = result.Value
+		if result.Err != nil {
+			if errors == nil {
+				errors = make([]error, len(results))
+			}
+			errors[i] = result.Err
+		}
+	}
+	return values, errors
+}
+
+// Results pairs up the values and errors returned by LoadAll, eg dataloader.Results(loader.LoadAll(keys))
+func Results[V any](values []V, errors []error) []Result[V] {
+	results := make([]Result[V], len(values))
+	for i := range results {
+		results[i].Value = values[i]
+		if i < len(errors) {
+			results[i].Err = errors[i]
+		}
+	}
+	return results
+}
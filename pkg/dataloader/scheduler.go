@@ -0,0 +1,54 @@
+package dataloader
+
+import (
+	"sync"
+	"time"
+)
+
+// Scheduler sends batches when Dispatch is called, instead of once the loader's Wait has passed. Sharing one between
+// every loader in a request lets a graphql executor send all of the batches for a resolution level at once, and makes
+// batching deterministic in tests.
+type Scheduler struct {
+	wait    time.Duration
+	timer   *time.Timer
+	pending []func()
+	mu      sync.Mutex
+}
+
+// NewScheduler creates a Scheduler that only sends batches when Dispatch is called
+func NewScheduler() *Scheduler {
+	return &Scheduler{}
+}
+
+// NewTimedScheduler creates a Scheduler that also dispatches wait after the first batch since the last Dispatch was
+// started, so the loaders sharing it have a single wait window between them instead of one each. A wait of 0 only
+// dispatches when Dispatch is called.
+func NewTimedScheduler(wait time.Duration) *Scheduler {
+	return &Scheduler{wait: wait}
+}
+
+// Schedule queues dispatch to be called by the next Dispatch. Loaders call it when they start a new batch.
+func (s *Scheduler) Schedule(dispatch func()) {
+	s.mu.Lock()
+	if s.wait > 0 && len(s.pending) == 0 {
+		s.timer = time.AfterFunc(s.wait, s.Dispatch)
+	}
+	s.pending = append(s.pending, dispatch)
+	s.mu.Unlock()
+}
+
+// Dispatch sends every batch started since the last Dispatch. It doesn't wait for them to be fetched.
+func (s *Scheduler) Dispatch() {
+	s.mu.Lock()
+	pending := s.pending
+	s.pending = nil
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	s.mu.Unlock()
+
+	for _, dispatch := range pending {
+		dispatch()
+	}
+}
@@ -0,0 +1,59 @@
+package dataloader
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestScheduler(t *testing.T) {
+	var fetches []string
+	var mu sync.Mutex
+	s := NewScheduler()
+
+	ints := New(Config[int, string]{
+		Scheduler: s,
+		Fetch: func(keys []int) ([]string, []error) {
+			mu.Lock()
+			fetches = append(fetches, "ints")
+			mu.Unlock()
+
+			values := make([]string, len(keys))
+			for i, key := range keys {
+				values[i] = strconv.Itoa(key)
+			}
+			return values, nil
+		},
+	})
+	strs := New(Config[string, string]{
+		Scheduler: s,
+		Fetch: func(keys []string) ([]string, []error) {
+			mu.Lock()
+			fetches = append(fetches, "strings")
+			mu.Unlock()
+			return keys, nil
+		},
+	})
+
+	intThunk := ints.LoadAllThunk([]int{1, 2})
+	strThunk := strs.LoadThunk("a")
+	time.Sleep(10 * time.Millisecond)
+	mu.Lock()
+	require.Empty(t, fetches, "nothing is sent until the scheduler dispatches")
+	mu.Unlock()
+
+	s.Dispatch()
+	values, errs := intThunk()
+	require.Equal(t, []string{"1", "2"}, values)
+	require.Equal(t, []error{nil, nil}, errs)
+	v, err := strThunk()
+	require.NoError(t, err)
+	require.Equal(t, "a", v)
+	require.ElementsMatch(t, []string{"ints", "strings"}, fetches)
+
+	s.Dispatch()
+	require.Len(t, fetches, 2, "dispatching with nothing pending does nothing")
+}
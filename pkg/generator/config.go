@@ -0,0 +1,69 @@
+package generator
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Config declares many loaders to generate in one go, it is read from a yaml file like
+//
+//	loaders:
+//	  - name: UserLoader
+//	    key: string
+//	    value: "*github.com/my/package.User"
+//	  - name: UserSliceLoader
+//	    key: int
+//	    value: "[]github.com/my/package.User"
+//	    output: slice/usersliceloader_gen.go
+//	    options:
+//	      context: true
+type Config struct {
+	Loaders []Loader `yaml:"loaders"`
+
+	// Dir is the directory containing the config file, output paths are relative to it
+	Dir string `yaml:"-"`
+}
+
+// GenerateFromConfig generates every loader declared in the config file, output paths are relative to the file
+func GenerateFromConfig(filename string) error {
+	cfg, err := ReadConfig(filename)
+	if err != nil {
+		return err
+	}
+
+	return GenerateLoaders(cfg.Dir, cfg.Loaders)
+}
+
+// ReadConfig reads and validates a config file
+func ReadConfig(filename string) (*Config, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading config")
+	}
+	defer f.Close()
+
+	var cfg Config
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, errors.Wrap(err, "parsing "+filename)
+	}
+
+	for i, loader := range cfg.Loaders {
+		if err := loader.Validate(); err != nil {
+			return nil, fmt.Errorf("%s: loader %d: %s", filename, i+1, err.Error())
+		}
+	}
+
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Dir = filepath.Dir(abs)
+
+	return &cfg, nil
+}
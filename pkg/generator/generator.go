@@ -3,157 +3,309 @@ package generator
 import (
 	"bytes"
 	"fmt"
+	"go/token"
+	"go/types"
 	"os"
 	"path/filepath"
-	"regexp"
 	"strings"
 	"unicode"
 
 	"github.com/pkg/errors"
+	"github.com/pmezard/go-difflib/difflib"
 	"golang.org/x/tools/go/packages"
 	"golang.org/x/tools/imports"
 )
 
+// Options toggle the optional features of a generated loader
+type Options struct {
+	// Context generates a Fetch that receives the batch context, along with LoadCtx and LoadThunkCtx
+	Context bool `yaml:"context"`
+
+	// MapFetch generates a Fetch that returns a map keyed by K, leaving the loader to line the results up with the keys
+	MapFetch bool `yaml:"map"`
+
+	// Cache lets the Config take a dataloader.Cache in place of the built in unbounded map
+	Cache bool `yaml:"cache"`
+
+	// Generic generates a thin wrapper over the dataloader.Loader runtime package instead of the full loader
+	Generic bool `yaml:"generic"`
+
+	// CacheKey is a comparable go type, eg string. When set the Config takes a CacheKeyFn deriving one from each key,
+	// and the loader dedups and caches on it, so the key type itself doesn't need to be comparable.
+	CacheKey string `yaml:"cacheKey"`
+
+	// Result generates a Fetch that returns a dataloader.Result for each key, and LoadAll methods that return them,
+	// in place of parallel slices of values and errors
+	Result bool `yaml:"result"`
+
+	// Middleware generates With<Name> and <Name>From context accessors, and an http middleware that creates a new
+	// loader for every request
+	Middleware bool `yaml:"middleware"`
+}
+
+// Loader describes a single loader to generate
+type Loader struct {
+	// Name is the name of the generated type, eg UserLoader
+	Name string `yaml:"name"`
+
+	// KeyType and ValueType are go types, named types are qualified with their full import path
+	// eg []*github.com/my/package.User
+	KeyType   string `yaml:"key"`
+	ValueType string `yaml:"value"`
+
+	// Output is the file to write, defaults to the lowercase name with a _gen.go suffix
+	Output string `yaml:"output"`
+
+	// Package overrides the package name of the generated file, defaults to the package already in its directory
+	Package string `yaml:"package"`
+
+	Options Options `yaml:"options"`
+}
+
 type templateData struct {
 	Package string
 	Name    string
 	KeyType *goType
 	ValType *goType
-}
 
-type goType struct {
-	Modifiers  string
-	ImportPath string
-	ImportName string
-	Name       string
+	// CacheKeyType is what the loader dedups and caches on, the KeyType unless a CacheKey was given
+	CacheKeyType *goType
+	Imports      []importSpec
+	Options
 }
 
-func (t *goType) String() string {
-	if t.ImportName != "" {
-		return t.Modifiers + t.ImportName + "." + t.Name
-	}
-
-	return t.Modifiers + t.Name
+func Generate(name string, keyType string, valueType string, wd string) error {
+	return GenerateWithOptions(name, keyType, valueType, wd, Options{})
 }
 
-func (t *goType) IsPtr() bool {
-	return strings.HasPrefix(t.Modifiers, "*")
+func GenerateWithOptions(name string, keyType string, valueType string, wd string, opts Options) error {
+	return GenerateLoaders(wd, []Loader{{Name: name, KeyType: keyType, ValueType: valueType, Options: opts}})
 }
 
-func (t *goType) IsSlice() bool {
-	return strings.HasPrefix(t.Modifiers, "[]")
+// File is a rendered loader, ready to be written to Path
+type File struct {
+	Path string
+	Src  []byte
 }
 
-var partsRe = regexp.MustCompile(`^([\[\]\*]*)(.*?)(\.\w*)?$`)
+// Write the file to disk
+func (f File) Write() error {
+	if err := os.WriteFile(f.Path, f.Src, 0644); err != nil {
+		return errors.Wrap(err, "writing output")
+	}
+	return nil
+}
 
-func parseType(str string) (*goType, error) {
-	parts := partsRe.FindStringSubmatch(str)
-	if len(parts) != 4 {
-		return nil, fmt.Errorf("type must be in the form []*github.com/import/path.Name")
+// Diff compares the file with what is on disk, returning a unified diff or an empty string if they match
+func (f File) Diff() (string, error) {
+	existing, err := os.ReadFile(f.Path)
+	if err != nil && !os.IsNotExist(err) {
+		return "", errors.Wrap(err, "reading existing output")
+	}
+	if bytes.Equal(existing, f.Src) {
+		return "", nil
 	}
 
-	t := &goType{
-		Modifiers:  parts[1],
-		ImportPath: parts[2],
-		Name:       strings.TrimPrefix(parts[3], "."),
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(existing)),
+		B:        difflib.SplitLines(string(f.Src)),
+		FromFile: f.Path,
+		ToFile:   f.Path + " (generated)",
+		Context:  3,
+	})
+}
+
+// GenerateLoaders writes every loader, looking up all of the packages they need in a single pass.
+// Relative output paths are relative to wd.
+func GenerateLoaders(wd string, loaders []Loader) error {
+	files, err := RenderLoaders(wd, loaders)
+	if err != nil {
+		return err
 	}
 
-	if t.Name == "" {
-		t.Name = t.ImportPath
-		t.ImportPath = ""
+	for _, f := range files {
+		if err := f.Write(); err != nil {
+			return err
+		}
 	}
 
-	if t.ImportPath != "" {
-		p, err := packages.Load(&packages.Config{Mode: packages.NeedName}, t.ImportPath)
-		if err != nil {
+	return nil
+}
+
+// RenderLoaders renders every loader without writing anything, returning a File for each loader in order.
+func RenderLoaders(wd string, loaders []Loader) ([]File, error) {
+	files := make([]File, len(loaders))
+	outputs := make([]string, len(loaders))
+	for i, loader := range loaders {
+		if err := loader.Validate(); err != nil {
 			return nil, err
 		}
-		if len(p) != 1 {
-			return nil, fmt.Errorf("not found")
-		}
 
-		t.ImportName = p[0].Name
+		outputs[i] = loader.Output
+		if outputs[i] == "" {
+			outputs[i] = strings.ToLower(loader.Name) + "_gen.go"
+		}
+		if !filepath.IsAbs(outputs[i]) {
+			outputs[i] = filepath.Join(wd, outputs[i])
+		}
 	}
 
-	return t, nil
-}
-
-func Generate(name string, keyType string, valueType string, wd string) error {
-	data, err := getData(name, keyType, valueType, wd)
+	data, err := getData(wd, loaders, outputs)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	filename := strings.ToLower(data.Name) + "_gen.go"
-
-	if err := writeTemplate(filepath.Join(wd, filename), data); err != nil {
-		return err
+	for i := range data {
+		files[i].Path = outputs[i]
+		files[i].Src, err = renderTemplate(outputs[i], data[i])
+		if err != nil {
+			return nil, errors.Wrap(err, loaders[i].Name)
+		}
 	}
 
+	return files, nil
+}
+
+// Validate checks that the loader is well formed, without looking up any of its types
+func (l Loader) Validate() error {
+	if !token.IsIdentifier(l.Name) {
+		return fmt.Errorf("%q is not a valid loader name", l.Name)
+	}
+	if _, err := parseType(l.KeyType); err != nil {
+		return fmt.Errorf("%s key type: %s", l.Name, err.Error())
+	}
+	if _, err := parseType(l.ValueType); err != nil {
+		return fmt.Errorf("%s value type: %s", l.Name, err.Error())
+	}
+	if l.Options.CacheKey != "" {
+		if _, err := parseType(l.Options.CacheKey); err != nil {
+			return fmt.Errorf("%s cache key type: %s", l.Name, err.Error())
+		}
+		if l.Options.Generic {
+			return fmt.Errorf("%s: cache keys are not supported by generic loaders", l.Name)
+		}
+	}
+	if l.Options.Generic && l.Options.MapFetch {
+		return fmt.Errorf("%s: map fetches are not supported by generic loaders, use dataloader.MapFetch", l.Name)
+	}
+	if l.Options.Result {
+		if l.Options.Generic {
+			return fmt.Errorf("%s: results are not supported by generic loaders, use dataloader.ResultFetch", l.Name)
+		}
+		if l.Options.MapFetch {
+			return fmt.Errorf("%s: results can't be combined with a map fetch", l.Name)
+		}
+	}
 	return nil
 }
 
-func getData(name string, keyType string, valueType string, wd string) (templateData, error) {
-	var data templateData
+func getData(wd string, loaders []Loader, outputs []string) ([]templateData, error) {
+	data := make([]templateData, len(loaders))
+	var patterns []string
 
-	genPkg := getPackage(wd)
-	if genPkg == nil {
-		return templateData{}, fmt.Errorf("unable to find package info for " + wd)
-	}
+	for i, loader := range loaders {
+		var err error
+		data[i].Name = loader.Name
+		data[i].Options = loader.Options
+		data[i].KeyType, err = parseType(loader.KeyType)
+		if err != nil {
+			return nil, fmt.Errorf("%s key type: %s", loader.Name, err.Error())
+		}
+		data[i].ValType, err = parseType(loader.ValueType)
+		if err != nil {
+			return nil, fmt.Errorf("%s value type: %s", loader.Name, err.Error())
+		}
+		data[i].CacheKeyType = data[i].KeyType
+		if loader.Options.CacheKey != "" {
+			data[i].CacheKeyType, err = parseType(loader.Options.CacheKey)
+			if err != nil {
+				return nil, fmt.Errorf("%s cache key type: %s", loader.Name, err.Error())
+			}
+		}
 
-	var err error
-	data.Name = name
-	data.Package = genPkg.Name
-	data.KeyType, err = parseType(keyType)
-	if err != nil {
-		return templateData{}, fmt.Errorf("key type: %s", err.Error())
+		patterns = append(patterns, filepath.Dir(outputs[i]))
+		patterns = append(patterns, data[i].KeyType.importPaths()...)
+		patterns = append(patterns, data[i].ValType.importPaths()...)
+		patterns = append(patterns, data[i].CacheKeyType.importPaths()...)
 	}
-	data.ValType, err = parseType(valueType)
+
+	pkgs, err := packages.Load(&packages.Config{
+		Mode: packages.NeedName | packages.NeedFiles | packages.NeedTypes | packages.NeedSyntax | packages.NeedImports,
+		Dir:  wd,
+	}, patterns...)
 	if err != nil {
-		return templateData{}, fmt.Errorf("key type: %s", err.Error())
+		return nil, err
 	}
 
-	// if we are inside the same package as the type we don't need an import and can refer directly to the type
-	if genPkg.PkgPath == data.ValType.ImportPath {
-		data.ValType.ImportName = ""
-		data.ValType.ImportPath = ""
-	}
-	if genPkg.PkgPath == data.KeyType.ImportPath {
-		data.KeyType.ImportName = ""
-		data.KeyType.ImportPath = ""
+	byPath := map[string]*packages.Package{}
+	byDir := map[string]*packages.Package{}
+	for _, p := range pkgs {
+		byPath[p.PkgPath] = p
+		for _, f := range p.GoFiles {
+			byDir[filepath.Dir(f)] = p
+		}
 	}
 
-	return data, nil
-}
+	for i, loader := range loaders {
+		dir := filepath.Dir(outputs[i])
+		genPkg := byDir[dir]
+		if genPkg == nil && loader.Package == "" {
+			return nil, fmt.Errorf("unable to find package info for %s", dir)
+		}
+
+		data[i].Package = loader.Package
+		if data[i].Package == "" {
+			data[i].Package = genPkg.Name
+		}
+
+		// types in the same package as the loader are referred to directly, without an import
+		var local *types.Package
+		imports := newFileImports("", templatePaths(loader.Options))
+		if genPkg != nil {
+			local = genPkg.Types
+			imports = newFileImports(genPkg.PkgPath, templatePaths(loader.Options))
+		}
 
-func getPackage(dir string) *packages.Package {
-	p, _ := packages.Load(&packages.Config{
-		Dir: dir,
-	}, ".")
+		resolve := []*goType{data[i].KeyType, data[i].ValType}
+		if data[i].CacheKeyType != data[i].KeyType {
+			resolve = append(resolve, data[i].CacheKeyType)
+		}
+		for _, t := range resolve {
+			if err := t.resolve(local, byPath, imports); err != nil {
+				return nil, fmt.Errorf("%s: %s", loader.Name, err.Error())
+			}
+		}
 
-	if len(p) != 1 {
-		return nil
+		// cache keys are used as map keys and compared with ==
+		if !types.Comparable(data[i].CacheKeyType.typ) {
+			if data[i].CacheKeyType != data[i].KeyType {
+				return nil, fmt.Errorf("%s: cache key type %s is not comparable", loader.Name, data[i].CacheKeyType.String())
+			}
+			return nil, fmt.Errorf("%s: key type %s is not comparable, use a cache key", loader.Name, data[i].KeyType.String())
+		}
+		data[i].Imports = imports.Imports
 	}
 
-	return p[0]
+	return data, nil
 }
 
-func writeTemplate(filepath string, data templateData) error {
+func renderTemplate(filepath string, data templateData) ([]byte, error) {
+	t := tpl
+	if data.Generic {
+		t = genericTpl
+	}
+
 	var buf bytes.Buffer
-	if err := tpl.Execute(&buf, data); err != nil {
-		return errors.Wrap(err, "generating code")
+	if err := t.Execute(&buf, data); err != nil {
+		return nil, errors.Wrap(err, "generating code")
 	}
 
 	src, err := imports.Process(filepath, buf.Bytes(), nil)
 	if err != nil {
-		return errors.Wrap(err, "unable to gofmt")
+		return nil, errors.Wrap(err, "unable to gofmt")
 	}
 
-	if err := os.WriteFile(filepath, src, 0644); err != nil {
-		return errors.Wrap(err, "writing output")
-	}
-
-	return nil
+	return src, nil
 }
 
 func lcFirst(s string) string {
@@ -1,19 +1,41 @@
 package generator
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/require"
+	"golang.org/x/tools/go/packages"
 )
 
 func TestParseType(t *testing.T) {
-	require.Equal(t, &goType{Name: "string"}, parse("string"))
-	require.Equal(t, &goType{Name: "Time", ImportPath: "time", ImportName: "time"}, parse("time.Time"))
-	require.Equal(t, &goType{
-		Name:       "Foo",
-		ImportPath: "github.com/vektah/dataloaden/pkg/generator/testdata/mismatch",
-		ImportName: "mismatched",
-	}, parse("github.com/vektah/dataloaden/pkg/generator/testdata/mismatch.Foo"))
+	require.Equal(t, map[string]string{}, parse("string").imports)
+	require.Equal(t, map[string]string{"dataloaden_import_0": "time"}, parse("map[time.Time][]*time.Duration").imports)
+	require.Equal(t, map[string]string{
+		"dataloaden_import_0": "github.com/vektah/dataloaden/pkg/generator/testdata/mismatch",
+		"dataloaden_import_1": "time",
+	}, parse("github.com/vektah/dataloaden/pkg/generator/testdata/mismatch.Page[*time.Time]").imports)
+
+	for _, valid := range []string{"[4]byte", "[]*[]int", "map[string]*github.com/my/package.User", "gopkg.in/yaml.v3.Node", "struct{A, B string; C []time.Time `json:\"c\"`}", "interface{}"} {
+		_, err := parseType(valid)
+		require.NoError(t, err, valid)
+	}
+
+	_, err := parseType("")
+	require.Error(t, err)
+	_, err = parseType("[]*")
+	require.EqualError(t, err, "must be in the form []*github.com/import/path.Name")
+	_, err = parseType("(int).X")
+	require.EqualError(t, err, "must be in the form []*github.com/import/path.Name")
+	_, err = parseType("chan int")
+	require.EqualError(t, err, "channels are not supported")
+	_, err = parseType("func()")
+	require.EqualError(t, err, "only named, pointer, slice, array, map, struct, interface and generic types are supported")
+	_, err = parseType("struct{time.Time}")
+	require.EqualError(t, err, "embedded fields are not supported")
+	_, err = parseType("interface{ String() string }")
+	require.EqualError(t, err, "only empty interfaces are supported")
 }
 
 func parse(s string) *goType {
@@ -24,3 +46,241 @@ func parse(s string) *goType {
 
 	return t
 }
+
+func TestGetData(t *testing.T) {
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+
+	data, err := getData(wd, []Loader{
+		{Name: "FooLoader", KeyType: "string", ValueType: "*github.com/vektah/dataloaden/pkg/generator/testdata/mismatch.Foo"},
+		{Name: "TimeLoader", KeyType: "time.Time", ValueType: "[]github.com/vektah/dataloaden/pkg/generator/testdata/mismatch.Foo"},
+	}, []string{
+		filepath.Join(wd, "fooloader_gen.go"),
+		filepath.Join(wd, "testdata", "mismatch", "timeloader_gen.go"),
+	})
+	require.NoError(t, err)
+
+	require.Equal(t, "generator", data[0].Package)
+	require.Equal(t, "*mismatched.Foo", data[0].ValType.String())
+
+	require.Equal(t, "mismatched", data[1].Package)
+	require.Equal(t, "time.Time", data[1].KeyType.String())
+	require.Equal(t, "[]Foo", data[1].ValType.String(), "types in the generated package dont need an import")
+
+	_, err = getData(wd, []Loader{
+		{Name: "FooLoader", KeyType: "string", ValueType: "github.com/vektah/dataloaden/does/not/exist.Foo"},
+	}, []string{filepath.Join(wd, "fooloader_gen.go")})
+	require.EqualError(t, err, "FooLoader: unable to find package github.com/vektah/dataloaden/does/not/exist")
+}
+
+func TestGetDataTypeExpressions(t *testing.T) {
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+
+	data, err := getData(wd, []Loader{
+		{Name: "MapLoader", KeyType: "[4]byte", ValueType: "map[string]*github.com/vektah/dataloaden/pkg/generator/testdata/mismatch.Foo"},
+		{Name: "PageLoader", KeyType: "int", ValueType: "*github.com/vektah/dataloaden/pkg/generator/testdata/mismatch.Page[[]*time.Time]"},
+		{Name: "TemplateLoader", KeyType: "*text/template.Template", ValueType: "[]*html/template.Template"},
+	}, []string{
+		filepath.Join(wd, "maploader_gen.go"),
+		filepath.Join(wd, "pageloader_gen.go"),
+		filepath.Join(wd, "templateloader_gen.go"),
+	})
+	require.NoError(t, err)
+
+	require.Equal(t, "[4]byte", data[0].KeyType.String())
+	require.Equal(t, "map[string]*mismatched.Foo", data[0].ValType.String())
+	require.Equal(t, "Foo", data[0].ValType.Name())
+	require.False(t, data[0].ValType.IsPtr())
+
+	require.Equal(t, "*mismatched.Page[[]*time.Time]", data[1].ValType.String())
+	require.Equal(t, "Page", data[1].ValType.Name())
+	require.True(t, data[1].ValType.IsPtr())
+	require.Equal(t, []importSpec{
+		{Path: "github.com/vektah/dataloaden/pkg/generator/testdata/mismatch"},
+	}, data[1].Imports, "packages the template imports aren't imported again")
+
+	require.Equal(t, "*template.Template", data[2].KeyType.String())
+	require.Equal(t, "[]*template2.Template", data[2].ValType.String(), "packages with the same name are aliased")
+	require.Equal(t, []importSpec{
+		{Path: "text/template"},
+		{Alias: "template2", Path: "html/template"},
+	}, data[2].Imports)
+
+	data, err = getData(wd, []Loader{
+		{Name: "UserLoader", KeyType: "time.Time", ValueType: "*github.com/vektah/dataloaden/pkg/generator/testdata/dataloader.User"},
+	}, []string{filepath.Join(wd, "userloader_gen.go")})
+	require.NoError(t, err)
+	require.Equal(t, "time.Time", data[0].KeyType.String(), "packages the template imports aren't aliased")
+	require.Equal(t, "*dataloader2.User", data[0].ValType.String(), "packages named like a template import are aliased")
+	require.Equal(t, []importSpec{
+		{Alias: "dataloader2", Path: "github.com/vektah/dataloaden/pkg/generator/testdata/dataloader"},
+	}, data[0].Imports)
+
+	_, err = getData(wd, []Loader{
+		{Name: "FooLoader", KeyType: "string", ValueType: "github.com/vektah/dataloaden/pkg/generator/testdata/mismatch.Bar"},
+	}, []string{filepath.Join(wd, "fooloader_gen.go")})
+	require.EqualError(t, err, "FooLoader: unable to find type Bar in github.com/vektah/dataloaden/pkg/generator/testdata/mismatch")
+}
+
+func TestRenderLoadersCompile(t *testing.T) {
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	dir, err := os.MkdirTemp(filepath.Join(wd, "testdata"), "compile")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	foo := "github.com/vektah/dataloaden/pkg/generator/testdata/mismatch.Foo"
+	files, err := RenderLoaders(dir, []Loader{
+		{Name: "TimeLoader", KeyType: "time.Time", ValueType: "*" + foo, Package: "compile"},
+		{Name: "TimeMapLoader", KeyType: "time.Time", ValueType: "[][]" + foo, Package: "compile", Options: Options{MapFetch: true}},
+		{Name: "RequestLoader", KeyType: "string", ValueType: "*net/http.Request", Package: "compile", Options: Options{Middleware: true, Context: true}},
+		{Name: "TimeGenericLoader", KeyType: "time.Time", ValueType: "*" + foo, Package: "compile", Options: Options{Generic: true}},
+		{Name: "RequestGenericLoader", KeyType: "time.Duration", ValueType: "*net/http.Request", Package: "compile", Options: Options{Generic: true}},
+		{Name: "QueryLoader", KeyType: "struct{TenantID string; Filters []string}", ValueType: "[]*" + foo, Package: "compile", Options: Options{CacheKey: "string"}},
+		{Name: "AnyGenericLoader", KeyType: "struct{ID int; At time.Time}", ValueType: "any", Package: "compile", Options: Options{Generic: true}},
+	})
+	require.NoError(t, err)
+	for _, f := range files {
+		require.NoError(t, f.Write())
+	}
+
+	pkgs, err := packages.Load(&packages.Config{Mode: packages.NeedTypes, Dir: dir}, ".")
+	require.NoError(t, err)
+	require.Len(t, pkgs, 1)
+	require.Empty(t, pkgs[0].Errors, "generated loaders should compile")
+}
+
+func TestGetDataChecksTypes(t *testing.T) {
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	mismatch := filepath.Join(wd, "testdata", "mismatch")
+
+	_, err = getData(wd, []Loader{
+		{Name: "FooLoader", KeyType: "[]string", ValueType: "string"},
+	}, []string{filepath.Join(wd, "fooloader_gen.go")})
+	require.EqualError(t, err, "FooLoader: key type []string is not comparable, use a cache key")
+
+	_, err = getData(wd, []Loader{
+		{Name: "FooLoader", KeyType: "map[string]int", ValueType: "string"},
+	}, []string{filepath.Join(wd, "fooloader_gen.go")})
+	require.EqualError(t, err, "FooLoader: key type map[string]int is not comparable, use a cache key")
+
+	data, err := getData(wd, []Loader{
+		{Name: "FooLoader", KeyType: "[]string", ValueType: "string", Options: Options{CacheKey: "string"}},
+	}, []string{filepath.Join(wd, "fooloader_gen.go")})
+	require.NoError(t, err, "keys don't need to be comparable with a cache key")
+	require.Equal(t, "string", data[0].CacheKeyType.String())
+
+	data, err = getData(wd, []Loader{
+		{Name: "FooLoader", KeyType: "struct{TenantID string; Filters []time.Time}", ValueType: "interface{}", Options: Options{CacheKey: "string"}},
+	}, []string{filepath.Join(wd, "fooloader_gen.go")})
+	require.NoError(t, err, "struct and interface literals can be used")
+	require.Equal(t, "struct{TenantID string; Filters []time.Time}", data[0].KeyType.String())
+	require.Equal(t, "interface{}", data[0].ValType.String())
+
+	_, err = getData(wd, []Loader{
+		{Name: "FooLoader", KeyType: "string", ValueType: "string", Options: Options{CacheKey: "[]string"}},
+	}, []string{filepath.Join(wd, "fooloader_gen.go")})
+	require.EqualError(t, err, "FooLoader: cache key type []string is not comparable")
+
+	_, err = getData(wd, []Loader{
+		{Name: "FooLoader", KeyType: "string", ValueType: "*github.com/vektah/dataloaden/pkg/generator/testdata/mismatch.unexported"},
+	}, []string{filepath.Join(wd, "fooloader_gen.go")})
+	require.EqualError(t, err, "FooLoader: github.com/vektah/dataloaden/pkg/generator/testdata/mismatch.unexported is not exported")
+
+	_, err = getData(wd, []Loader{
+		{Name: "FooLoader", KeyType: "string", ValueType: "Fooo"},
+	}, []string{filepath.Join(mismatch, "fooloader_gen.go")})
+	require.EqualError(t, err, "FooLoader: unknown type Fooo")
+
+	data, err = getData(wd, []Loader{
+		{Name: "FooLoader", KeyType: "github.com/vektah/dataloaden/pkg/generator/testdata/mismatch.Foo", ValueType: "*unexported"},
+	}, []string{filepath.Join(mismatch, "fooloader_gen.go")})
+	require.NoError(t, err, "unexported types can be used from inside their own package")
+	require.Equal(t, "Foo", data[0].KeyType.String())
+	require.Equal(t, "*unexported", data[0].ValType.String())
+}
+
+func TestReadConfig(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "dataloaden.yml")
+
+	require.NoError(t, os.WriteFile(filename, []byte(`
+loaders:
+  - name: UserLoader
+    key: string
+    value: "*github.com/my/package.User"
+    output: users/userloader_gen.go
+    package: users
+    options:
+      context: true
+      cache: true
+`), 0644))
+
+	cfg, err := ReadConfig(filename)
+	require.NoError(t, err)
+	require.Equal(t, dir, cfg.Dir)
+	require.Equal(t, []Loader{{
+		Name:      "UserLoader",
+		KeyType:   "string",
+		ValueType: "*github.com/my/package.User",
+		Output:    "users/userloader_gen.go",
+		Package:   "users",
+		Options:   Options{Context: true, Cache: true},
+	}}, cfg.Loaders)
+
+	require.NoError(t, os.WriteFile(filename, []byte(`
+loaders:
+  - name: UserLoader
+    key: string
+    value: "*github.com/my/package.User"
+    options:
+      contxt: true
+`), 0644))
+	_, err = ReadConfig(filename)
+	require.Error(t, err, "unknown options are rejected")
+
+	require.NoError(t, os.WriteFile(filename, []byte(`
+loaders:
+  - name: UserLoader
+    key: string
+`), 0644))
+	_, err = ReadConfig(filename)
+	require.EqualError(t, err, filename+": loader 1: UserLoader value type: must be in the form []*github.com/import/path.Name")
+}
+
+func TestLoaderValidate(t *testing.T) {
+	loader := Loader{Name: "UserLoader", KeyType: "string", ValueType: "*github.com/my/package.User"}
+	require.NoError(t, loader.Validate())
+
+	loader.Options = Options{Generic: true, MapFetch: true}
+	require.EqualError(t, loader.Validate(), "UserLoader: map fetches are not supported by generic loaders, use dataloader.MapFetch")
+
+	loader.Options = Options{Generic: true, Result: true}
+	require.EqualError(t, loader.Validate(), "UserLoader: results are not supported by generic loaders, use dataloader.ResultFetch")
+
+	loader.Options = Options{MapFetch: true, Result: true}
+	require.EqualError(t, loader.Validate(), "UserLoader: results can't be combined with a map fetch")
+
+	loader.Options = Options{Generic: true, CacheKey: "string"}
+	require.EqualError(t, loader.Validate(), "UserLoader: cache keys are not supported by generic loaders")
+}
+
+func TestFileDiff(t *testing.T) {
+	f := File{Path: filepath.Join(t.TempDir(), "userloader_gen.go"), Src: []byte("package a\n\nvar a = 1\n")}
+
+	diff, err := f.Diff()
+	require.NoError(t, err)
+	require.Contains(t, diff, "+var a = 1", "missing files are diffed against nothing")
+
+	require.NoError(t, f.Write())
+	diff, err = f.Diff()
+	require.NoError(t, err)
+	require.Empty(t, diff)
+
+	f.Src = []byte("package a\n\nvar a = 2\n")
+	diff, err = f.Diff()
+	require.NoError(t, err)
+	require.Contains(t, diff, "-var a = 1\n+var a = 2\n")
+}
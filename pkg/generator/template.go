@@ -2,48 +2,176 @@ package generator
 
 import "text/template"
 
-var tpl = template.Must(template.New("generated").
-	Funcs(template.FuncMap{
-		"lcFirst": lcFirst,
-	}).
-	Parse(`
+var funcs = template.FuncMap{
+	"lcFirst": lcFirst,
+}
+
+var tpl = template.Must(template.Must(template.New("generated").Funcs(funcs).Parse(middlewareTpl)).Parse(`
+{{- define "fetchType" -}}
+func({{if .Context}}ctx context.Context, {{end}}keys []{{.KeyType.String}}) (
+	{{- if .MapFetch}}map[{{.CacheKeyType.String}}]{{.ValType.String}}, error
+	{{- else if .Result}}[]dataloader.Result[{{.ValType.String}}]
+	{{- else}}[]{{.ValType.String}}, []error{{end -}}
+)
+{{- end}}
+{{- define "loadAllType" -}}
+{{if .Result}}[]dataloader.Result[{{.ValType.String}}]{{else}}([]{{.ValType.String}}, []error){{end}}
+{{- end}}
+{{- $ck := "key"}}{{if .CacheKey}}{{$ck = "cacheKey"}}{{end}}
 // Code generated by github.com/vektah/dataloaden, DO NOT EDIT.
 
 package {{.Package}}
 
 import (
+    "context"
+    "log/slog"
+    {{- if .Middleware}}
+    "net/http"
+    {{- end}}
     "sync"
     "time"
 
-    {{if .KeyType.ImportPath}}"{{.KeyType.ImportPath}}"{{end}}
-    {{if .ValType.ImportPath}}"{{.ValType.ImportPath}}"{{end}}
+    "github.com/vektah/dataloaden/pkg/dataloader"
+
+    {{range .Imports -}}
+    {{.Alias}} "{{.Path}}"
+    {{end -}}
 )
 
 // {{.Name}}Config captures the config to create a new {{.Name}}
 type {{.Name}}Config struct {
 	// Fetch is a method that provides the data for the loader 
-	Fetch func(keys []{{.KeyType.String}}) ([]{{.ValType.String}}, []error)
+	{{- if .Context}}
+	// ctx is the batch context, it carries the values of the first caller in the batch and is only cancelled
+	// once every caller waiting on the batch has given up
+	{{- end}}
+	{{- if .MapFetch}}
+	// keys do not need to be in any particular order, and keys missing from the map are not found
+	{{- end}}
+	{{- if and .MapFetch .CacheKey}}
+	// the map is keyed by the cache key of each key
+	{{- end}}
+	{{- if .Result}}
+	// it returns a result for each key, in the same order as the keys
+	{{- end}}
+	Fetch {{template "fetchType" .}}
+
+	{{- if .MapFetch}}
+
+	// NotFound is the error returned for keys missing from the map returned by Fetch, defaults to
+	// dataloader.ErrNotFound. Keys that aren't found are cached, and LoadOptional reports them as missing instead
+	// of as an error.
+	{{- else}}
+
+	// NotFound is an error Fetch returns for keys that don't exist, as well as dataloader.ErrNotFound. Keys that
+	// aren't found are cached, and LoadOptional reports them as missing instead of as an error.
+	{{- end}}
+	NotFound error
+	{{- if .CacheKey}}
+
+	// CacheKeyFn derives the key that keys are deduped and cached by, keys with the same cache key share a result.
+	// It is required.
+	CacheKeyFn func(key {{.KeyType.String}}) {{.CacheKeyType.String}}
+	{{- end}}
 
 	// Wait is how long wait before sending a batch
 	Wait time.Duration
 
 	// MaxBatch will limit the maximum number of keys to send in one batch, 0 = not limit
 	MaxBatch int
+
+	// DispatchOnThunk sends a batch as soon as one of its thunks is called, instead of waiting for Wait to pass.
+	// Load calls its thunk straight away, so queue keys with LoadThunk or LoadAll to batch them.
+	DispatchOnThunk bool
+
+	// Scheduler sends batches when its Dispatch is called, instead of once Wait has passed. Loaders sharing a
+	// scheduler have their batches sent together.
+	Scheduler *dataloader.Scheduler
+
+	// Registry registers the loader under its name, and unless Scheduler is set sends its batches with the
+	// registry's scheduler.
+	Registry *dataloader.Registry
+
+	// Hooks are called as the loader works, to record metrics or trace batches
+	Hooks *dataloader.Hooks
+
+	// Logger logs batches slower than SlowBatchThreshold, and warns when batches keep being sent with a single key
+	Logger *slog.Logger
+
+	// SlowBatchThreshold is how long fetch can take before the batch is logged, 0 never logs slow batches
+	SlowBatchThreshold time.Duration
+
+	// PanicHandler is called with any panic recovered from Fetch, after every waiter has been given the error.
+	// It can be used to log the panic, or to re-panic and crash like an unrecovered panic would.
+	PanicHandler func(err *dataloader.PanicError)
+
+	// CacheErrors decides which errors returned by Fetch are cached and replayed to later loads of the same key.
+	// nil caches no errors, dataloader.CacheAllErrors caches every error.
+	{{- if .Cache}}
+	// They are stored in Cache, and evicted like values.
+	{{- end}}
+	CacheErrors func(err error) bool
+	{{- if .Cache}}
+
+	// Cache stores fetched values, defaults to an unbounded dataloader.NewMapCache. Cached errors and keys that
+	// weren't found are only stored if it implements dataloader.ErrorCache.
+	Cache dataloader.Cache[{{.CacheKeyType.String}}, {{.ValType.String}}]
+	{{- end}}
 }
 
 // New{{.Name}} creates a new {{.Name}} given a fetch, wait, and maxBatch
 func New{{.Name}}(config {{.Name}}Config) *{{.Name}} {
-	return &{{.Name}}{
+	{{- if .CacheKey}}
+	if config.CacheKeyFn == nil {
+		panic("{{.Name}}: CacheKeyFn is required")
+	}
+	{{- end}}
+	l := &{{.Name}}{
 		fetch: config.Fetch,
 		wait: config.Wait,
 		maxBatch: config.MaxBatch,
+		dispatchOnThunk: config.DispatchOnThunk,
+		scheduler: config.Scheduler,
+		hooks: config.Hooks,
+		logger: config.Logger,
+		slowBatchThreshold: config.SlowBatchThreshold,
+		panicHandler: config.PanicHandler,
+		cacheErrors: config.CacheErrors,
+		notFound: config.NotFound,
+		{{- if .CacheKey}}
+		cacheKeyFn: config.CacheKeyFn,
+		{{- end}}
+		{{- if .Cache}}
+		cache: config.Cache,
+		{{- end}}
+	}
+	{{- if .MapFetch}}
+	if l.notFound == nil {
+		l.notFound = dataloader.ErrNotFound
 	}
+	{{- end}}
+	if config.Registry != nil {
+		if l.scheduler == nil {
+			l.scheduler = config.Registry.Scheduler()
+		}
+		config.Registry.Register("{{.Name}}", l)
+	}
+	return l
 }
 
 // {{.Name}} batches and caches requests          
 type {{.Name}} struct {
 	// this method provides the data for the loader
-	fetch func(keys []{{.KeyType.String}}) ([]{{.ValType.String}}, []error)
+	fetch {{template "fetchType" .}}
+
+
+	// the error {{if .MapFetch}}returned for keys missing from the fetch results{{else}}fetch returns for keys that don't exist{{end}}
+	notFound error
+	{{- if .CacheKey}}
+
+	// derives the key that keys are deduped and cached by
+	cacheKeyFn func(key {{.KeyType.String}}) {{.CacheKeyType.String}}
+	{{- end}}
 
 	// how long to done before sending a batch
 	wait time.Duration
@@ -51,195 +179,811 @@ type {{.Name}} struct {
 	// this will limit the maximum number of keys to send in one batch, 0 = no limit
 	maxBatch int
 
-	// INTERNAL
+	// send the batch as soon as one of its thunks is called
+	dispatchOnThunk bool
+
+	// sends batches in place of the timer, if set
+	scheduler *dataloader.Scheduler
+
+	// called as the loader works
+	hooks *dataloader.Hooks
 
+	// logs slow batches and loaders that aren't batching
+	logger *slog.Logger
+
+	// how long fetch can take before the batch is logged
+	slowBatchThreshold time.Duration
+
+	// called with any panic recovered from fetch
+	panicHandler func(err *dataloader.PanicError)
+
+	// decides which fetch errors are cached
+	cacheErrors func(err error) bool
+
+	// INTERNAL
+{{if .Cache}}
+	// the cache, lazily created if one wasn't configured
+	cache dataloader.Cache[{{.CacheKeyType.String}}, {{.ValType.String}}]
+{{- else}}
 	// lazily created cache
-	cache map[{{.KeyType.String}}]{{.ValType.String}}
+	cache map[{{.CacheKeyType.String}}]{{.ValType.String}}
+{{- end}}
+
+	// counts the work done by the loader
+	stats dataloader.Stats
+
+	// how many batches in a row have been sent with a single key, only counted when there is a logger
+	singleKeyBatches int
+
+	{{- if not .Cache}}
+
+	// lazily created cache of errors picked by cacheErrors and keys that weren't found
+	errCache map[{{.CacheKeyType.String}}]error
+	{{- end}}
 
 	// the current batch. keys will continue to be collected until timeout is hit,
 	// then everything will be sent to the fetch method and out to the listeners
 	batch *{{.Name|lcFirst}}Batch
 
+	// batches that have been started but haven't cached their results yet
+	inflight map[*{{.Name|lcFirst}}Batch]bool
+
 	// mutex to prevent races
 	mu sync.Mutex
 }
 
 type {{.Name|lcFirst}}Batch struct {
 	keys    []{{.KeyType}}
+	{{- if .CacheKey}}
+	cacheKeys []{{.CacheKeyType}}
+	{{- end}}
+	index   map[{{.CacheKeyType}}]int
 	data    []{{.ValType.String}}
 	error   []error
 	closing bool
 	done    chan struct{}
+	timer   *time.Timer
+	start   time.Time
+	{{- if .Context}}
+
+	// the context passed to fetch, detached from the first caller and cancelled once every waiter has given up
+	ctx     context.Context
+	cancel  context.CancelFunc
+	waiters int
+	{{- end}}
+
+	// keys set or cleared since the batch started, their fetched results are stale and aren't cached
+	written map[{{.CacheKeyType}}]bool
+	cleared bool
 }
 
 // Load a {{.ValType.Name}} by key, batching and caching will be applied automatically
 func (l *{{.Name}}) Load(key {{.KeyType.String}}) ({{.ValType.String}}, error) {
 	return l.LoadThunk(key)()
 }
+{{- if .Context}}
+
+// LoadCtx loads a {{.ValType.Name}} by key, returning ctx.Err() as soon as ctx is done
+func (l *{{.Name}}) LoadCtx(ctx context.Context, key {{.KeyType.String}}) ({{.ValType.String}}, error) {
+	return l.LoadThunkCtx(ctx, key)()
+}
+{{- end}}
+
+// LoadOptional loads a {{.ValType.Name}} by key, returning false instead of an error if it doesn't exist
+func (l *{{.Name}}) LoadOptional(key {{.KeyType.String}}) ({{.ValType.String}}, bool, error) {
+	return l.optional(l.Load(key))
+}
+{{- if .Context}}
+
+// LoadOptionalCtx loads a {{.ValType.Name}} by key, returning false instead of an error if it doesn't exist
+func (l *{{.Name}}) LoadOptionalCtx(ctx context.Context, key {{.KeyType.String}}) ({{.ValType.String}}, bool, error) {
+	return l.optional(l.LoadCtx(ctx, key))
+}
+{{- end}}
+
+// optional turns not found errors into a missing value
+func (l *{{.Name}}) optional(value {{.ValType.String}}, err error) ({{.ValType.String}}, bool, error) {
+	if err == nil {
+		return value, true, nil
+	}
+
+	var zero {{.ValType.String}}
+	if dataloader.IsNotFound(err, l.notFound) {
+		return zero, false, nil
+	}
+	return zero, false, err
+}
 
 // LoadThunk returns a function that when called will block waiting for a {{.ValType.Name}}.
 // This method should be used if you want one goroutine to make requests to many
 // different data loaders without blocking until the thunk is called.
 func (l *{{.Name}}) LoadThunk(key {{.KeyType.String}}) func() ({{.ValType.String}}, error) {
+{{- if .Context}}
+	return l.LoadThunkCtx(context.Background(), key)
+}
+
+// LoadThunkCtx returns a function that when called will block waiting for a {{.ValType.Name}}, or until ctx is done.
+// The batch is fetched with a context carrying the values of the first caller to join it, which is only
+// cancelled once the context of every caller waiting on the batch has been cancelled.
+func (l *{{.Name}}) LoadThunkCtx(ctx context.Context, key {{.KeyType.String}}) func() ({{.ValType.String}}, error) {
+{{- end}}
+	{{- if .CacheKey}}
+	cacheKey := l.cacheKeyFn(key)
+	{{- end}}
+	l.hooks.Load("{{.Name}}")
 	l.mu.Lock()
-	if it, ok := l.cache[key]; ok {
+	l.stats.Loads++
+	if it, ok := {{if .Cache}}l.unsafeGet({{$ck}}){{else}}l.cache[{{$ck}}]{{end}}; ok {
+		l.stats.Hits++
 		l.mu.Unlock()
+		l.hooks.CacheHit("{{.Name}}")
 		return func() ({{.ValType.String}}, error) {
 			return it, nil
 		}
 	}
+	if err, ok := {{if .Cache}}dataloader.CacheGetError(l.cache, {{$ck}}){{else}}l.errCache[{{$ck}}]{{end}}; ok {
+		l.stats.Hits++
+		l.mu.Unlock()
+		l.hooks.CacheHit("{{.Name}}")
+		return func() ({{.ValType.String}}, error) {
+			var zero {{.ValType.String}}
+			return zero, err
+		}
+	}
 	if l.batch == nil {
-		l.batch = &{{.Name|lcFirst}}Batch{done: make(chan struct{})}
+		l.batch = &{{.Name|lcFirst}}Batch{index: map[{{.CacheKeyType}}]int{}, done: make(chan struct{})}
+		{{- if .Context}}
+		l.batch.ctx, l.batch.cancel = context.WithCancel(context.WithoutCancel(ctx))
+		{{- end}}
+		if l.inflight == nil {
+			l.inflight = map[*{{.Name|lcFirst}}Batch]bool{}
+		}
+		l.inflight[l.batch] = true
 	}
 	batch := l.batch
-	pos := batch.keyIndex(l, key)
+	pos := batch.keyIndex(l, key{{if .CacheKey}}, cacheKey{{end}})
+	{{- if .Context}}
+	batch.waiters++
+	{{- end}}
 	l.mu.Unlock()
+	{{- if .Context}}
 
-	return func() ({{.ValType.String}}, error) {
-		<-batch.done
-
-		var data {{.ValType.String}}
-		if pos < len(batch.data) {
-			data = batch.data[pos]
-		}
-
-		var err error
-		// its convenient to be able to return a single error for everything
-		if len(batch.error) == 1 {
-			err = batch.error[0]
-		} else if batch.error != nil {
-			err = batch.error[pos]
-		}
+	stop := context.AfterFunc(ctx, func() {
+		l.mu.Lock()
+		batch.abandon(l)
+		l.mu.Unlock()
+	})
+	{{- end}}
 
-		if err == nil {
+	return func() ({{.ValType.String}}, error) {
+		if l.dispatchOnThunk {
 			l.mu.Lock()
-			l.unsafeSet(key, data)
+			batch.dispatch(l)
 			l.mu.Unlock()
 		}
+{{if .Context}}
+		select {
+		case <-batch.done:
+			stop()
+		case <-ctx.Done():
+			var zero {{.ValType.String}}
+			return zero, ctx.Err()
+		}
+		{{- else}}
+		<-batch.done
+		{{- end}}
 
-		return data, err
+		return batch.result(pos)
 	}
 }
 
 // LoadAll fetches many keys at once. It will be broken into appropriate sized
 // sub batches depending on how the loader is configured
-func (l *{{.Name}}) LoadAll(keys []{{.KeyType}}) ([]{{.ValType.String}}, []error) {
+func (l *{{.Name}}) LoadAll(keys []{{.KeyType}}) {{template "loadAllType" .}} {
 	results := make([]func() ({{.ValType.String}}, error), len(keys))
 
 	for i, key := range keys {
 		results[i] = l.LoadThunk(key)
 	}
-
+{{if .Result}}
+	loaded := make([]dataloader.Result[{{.ValType.String}}], len(keys))
+	for i, thunk := range results {
+		loaded[i].Value, loaded[i].Err = thunk()
+	}
+	return loaded
+{{- else}}
 	{{.ValType.Name|lcFirst}}s := make([]{{.ValType.String}}, len(keys))
 	errors := make([]error, len(keys))
 	for i, thunk := range results {
 		{{.ValType.Name|lcFirst}}s[i], errors[i] = thunk()
 	}
 	return {{.ValType.Name|lcFirst}}s, errors
+{{- end}}
 }
 
+{{- if .Context}}
+
+// LoadAllCtx fetches many keys at once, any keys still pending when ctx is done will return ctx.Err()
+func (l *{{.Name}}) LoadAllCtx(ctx context.Context, keys []{{.KeyType}}) {{template "loadAllType" .}} {
+	return l.LoadAllThunkCtx(ctx, keys)()
+}
+{{- end}}
+
 // LoadAllThunk returns a function that when called will block waiting for a {{.ValType.Name}}s.
 // This method should be used if you want one goroutine to make requests to many
 // different data loaders without blocking until the thunk is called.
-func (l *{{.Name}}) LoadAllThunk(keys []{{.KeyType}}) (func() ([]{{.ValType.String}}, []error)) {
+func (l *{{.Name}}) LoadAllThunk(keys []{{.KeyType}}) func() {{template "loadAllType" .}} {
+{{- if .Context}}
+	return l.LoadAllThunkCtx(context.Background(), keys)
+}
+
+// LoadAllThunkCtx returns a function that when called will block waiting for a {{.ValType.Name}}s, or until ctx is done.
+func (l *{{.Name}}) LoadAllThunkCtx(ctx context.Context, keys []{{.KeyType}}) func() {{template "loadAllType" .}} {
+{{- end}}
 	results := make([]func() ({{.ValType.String}}, error), len(keys))
  	for i, key := range keys {
-		results[i] = l.LoadThunk(key)
+		results[i] = l.{{if .Context}}LoadThunkCtx(ctx, key){{else}}LoadThunk(key){{end}}
 	}
-	return func() ([]{{.ValType.String}}, []error) {
+	return func() {{template "loadAllType" .}} {
+		{{- if .Result}}
+		loaded := make([]dataloader.Result[{{.ValType.String}}], len(keys))
+		for i, thunk := range results {
+			loaded[i].Value, loaded[i].Err = thunk()
+		}
+		return loaded
+		{{- else}}
 		{{.ValType.Name|lcFirst}}s := make([]{{.ValType.String}}, len(keys))
 		errors := make([]error, len(keys))
 		for i, thunk := range results {
 			{{.ValType.Name|lcFirst}}s[i], errors[i] = thunk()
 		}
 		return {{.ValType.Name|lcFirst}}s, errors
+		{{- end}}
 	}
 }
 
-// Prime the cache with the provided key and value. If the key already exists, no change is made
-// and false is returned.
-// (To forcefully prime the cache, clear the key first with loader.clear(key).prime(key, value).)
+// Prime the cache with the provided key and value. If the key already has a value, no change is made
+// and false is returned. Priming replaces any cached error for the key.
+// (To forcefully prime the cache, use Set.)
 func (l *{{.Name}}) Prime(key {{.KeyType}}, value {{.ValType.String}}) bool {
+	{{- if .CacheKey}}
+	cacheKey := l.cacheKeyFn(key)
+	{{- end}}
 	l.mu.Lock()
 	var found bool
-	if _, found = l.cache[key]; !found {
-		{{- if .ValType.IsPtr }}
-			// make a copy when writing to the cache, its easy to pass a pointer in from a loop var
-			// and end up with the whole cache pointing to the same value.
-			cpy := *value
-			l.unsafeSet(key, &cpy)
-		{{- else if .ValType.IsSlice }}
-			// make a copy when writing to the cache, its easy to pass a pointer in from a loop var
-			// and end up with the whole cache pointing to the same value.
-			cpy := make({{.ValType.String}}, len(value))
-			copy(cpy, value)
-			l.unsafeSet(key, cpy)
-		{{- else }}
-			l.unsafeSet(key, value)
-		{{- end }}
+	if _, found = {{if .Cache}}l.unsafeGet({{$ck}}){{else}}l.cache[{{$ck}}]{{end}}; !found {
+		l.unsafePrime({{$ck}}, value)
 	}
 	l.mu.Unlock()
 	return !found
 }
 
-// Clear the value at key from the cache, if it exists
+// PrimeMany primes the cache with every value whose key doesn't already have a value, returning how many were
+// primed
+{{- if .CacheKey}}.
+// Values are keyed by their cache key, like the map returned by Snapshot.{{end}}
+func (l *{{.Name}}) PrimeMany(values map[{{.CacheKeyType}}]{{.ValType.String}}) int {
+	primed := 0
+	l.mu.Lock()
+	for key, value := range values {
+		if _, found := {{if .Cache}}l.unsafeGet(key){{else}}l.cache[key]{{end}}; !found {
+			l.unsafePrime(key, value)
+			primed++
+		}
+	}
+	l.mu.Unlock()
+	return primed
+}
+
+// Set the value for key in the cache, replacing any value or error already cached for it
+func (l *{{.Name}}) Set(key {{.KeyType}}, value {{.ValType.String}}) {
+	{{- if .CacheKey}}
+	cacheKey := l.cacheKeyFn(key)
+	{{- end}}
+	l.mu.Lock()
+	l.unsafePrime({{$ck}}, value)
+	l.mu.Unlock()
+}
+
+// SetMany sets every value in the cache at once, replacing any values or errors already cached for their keys
+{{- if .CacheKey}}.
+// Values are keyed by their cache key, like the map returned by Snapshot.{{end}}
+func (l *{{.Name}}) SetMany(values map[{{.CacheKeyType}}]{{.ValType.String}}) {
+	l.mu.Lock()
+	for key, value := range values {
+		l.unsafePrime(key, value)
+	}
+	l.mu.Unlock()
+}
+
+// Clear the value or error at key from the cache, if it exists
 func (l *{{.Name}}) Clear(key {{.KeyType}}) {
+	{{- if .CacheKey}}
+	cacheKey := l.cacheKeyFn(key)
+	{{- end}}
 	l.mu.Lock()
-	delete(l.cache, key)
+	l.unsafeClear({{$ck}})
+	l.mu.Unlock()
+}
+
+// ClearMany clears the values and errors at every key from the cache at once
+func (l *{{.Name}}) ClearMany(keys []{{.KeyType}}) {
+	{{- if .CacheKey}}
+	cacheKeys := make([]{{.CacheKeyType}}, len(keys))
+	for i, key := range keys {
+		cacheKeys[i] = l.cacheKeyFn(key)
+	}
+	{{- end}}
+	l.mu.Lock()
+	for _, key := range {{if .CacheKey}}cacheKeys{{else}}keys{{end}} {
+		l.unsafeClear(key)
+	}
+	l.mu.Unlock()
+}
+
+// ClearAll clears every value and error from the cache
+{{- if .Cache}}, a cache shared with other loaders is cleared for all of them{{end}}
+func (l *{{.Name}}) ClearAll() {
+	l.mu.Lock()
+	{{- if .Cache}}
+	if l.cache != nil {
+		l.cache.Clear()
+	}
+	{{- else}}
+	l.cache = nil
+	l.errCache = nil
+	{{- end}}
+	for b := range l.inflight {
+		b.cleared = true
+	}
+	l.mu.Unlock()
+}
+
+// Peek returns the cached {{.ValType.Name}} for key, without loading it if it isn't cached
+func (l *{{.Name}}) Peek(key {{.KeyType}}) ({{.ValType.String}}, bool) {
+	{{- if .CacheKey}}
+	cacheKey := l.cacheKeyFn(key)
+	{{- end}}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	{{- if .Cache}}
+	return l.unsafeGet({{$ck}})
+	{{- else}}
+	it, ok := l.cache[{{$ck}}]
+	return it, ok
+	{{- end}}
+}
+
+// Has reports whether a {{.ValType.Name}} is cached for key
+func (l *{{.Name}}) Has(key {{.KeyType}}) bool {
+	_, ok := l.Peek(key)
+	return ok
+}
+
+// Len is the number of cached {{.ValType.Name}}s
+{{- if .Cache}}, caches that don't implement dataloader.Ranger are always empty{{end}}
+func (l *{{.Name}}) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	{{- if .Cache}}
+	return dataloader.CacheLen(l.cache)
+	{{- else}}
+	return len(l.cache)
+	{{- end}}
+}
+
+// Snapshot copies the cached {{.ValType.Name}}s
+{{- if .CacheKey}} by their cache key{{end}}
+{{- if .Cache}}, caches that don't implement dataloader.Ranger are always empty{{end}}
+func (l *{{.Name}}) Snapshot() map[{{.CacheKeyType}}]{{.ValType.String}} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	{{- if .Cache}}
+	return dataloader.CacheSnapshot(l.cache)
+	{{- else}}
+	snapshot := make(map[{{.CacheKeyType}}]{{.ValType.String}}, len(l.cache))
+	for key, value := range l.cache {
+		snapshot[key] = value
+	}
+	return snapshot
+	{{- end}}
+}
+
+// Flush sends the current batch straight away, instead of waiting for it to fill up or for wait to pass
+func (l *{{.Name}}) Flush() {
+	l.mu.Lock()
+	if l.batch != nil {
+		l.batch.dispatch(l)
+	}
 	l.mu.Unlock()
 }
 
-func (l *{{.Name}}) unsafeSet(key {{.KeyType}}, value {{.ValType.String}}) {
+// logBatch logs batches slower than slowBatchThreshold, and warns when batches keep being sent with a single key
+func (l *{{.Name}}) logBatch(keys []{{.KeyType}}, duration time.Duration) {
+	if l.logger == nil {
+		return
+	}
+
+	if l.slowBatchThreshold > 0 && duration >= l.slowBatchThreshold {
+		l.logger.Warn("slow dataloader batch", "loader", "{{.Name}}", "keys", len(keys), "sample", dataloader.KeySample(keys), "duration", duration)
+	}
+
+	l.mu.Lock()
+	if len(keys) == 1 {
+		l.singleKeyBatches++
+	} else {
+		l.singleKeyBatches = 0
+	}
+	singleKeyBatches := l.singleKeyBatches
+	notBatching := singleKeyBatches > 0 && singleKeyBatches%dataloader.SingleKeyBatchWarning == 0
+	l.mu.Unlock()
+
+	if notBatching {
+		l.logger.Warn("dataloader is not batching", "loader", "{{.Name}}", "singleKeyBatches", singleKeyBatches, "wait", l.wait)
+	}
+}
+
+// Stats counts the keys loaded and fetched by the loader
+func (l *{{.Name}}) Stats() dataloader.Stats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.stats
+}
+{{- if .Cache}}
+
+func (l *{{.Name}}) unsafeGet(key {{.CacheKeyType}}) ({{.ValType.String}}, bool) {
+	if l.cache == nil {
+		var zero {{.ValType.String}}
+		return zero, false
+	}
+	return l.cache.Get(key)
+}
+{{- end}}
+
+func (l *{{.Name}}) unsafeSet(key {{.CacheKeyType}}, value {{.ValType.String}}) {
 	if l.cache == nil {
-		l.cache = map[{{.KeyType}}]{{.ValType.String}}{}
+		{{- if .Cache}}
+		l.cache = dataloader.NewMapCache[{{.CacheKeyType}}, {{.ValType.String}}]()
+		{{- else}}
+		l.cache = map[{{.CacheKeyType}}]{{.ValType.String}}{}
+		{{- end}}
 	}
+	{{- if .Cache}}
+	l.cache.Set(key, value)
+	{{- else}}
 	l.cache[key] = value
+	delete(l.errCache, key)
+	{{- end}}
+}
+
+// unsafePrime stores a copy of value, its easy to pass a pointer in from a loop var and end up with the whole
+// cache pointing to the same value.
+func (l *{{.Name}}) unsafePrime(key {{.CacheKeyType}}, value {{.ValType.String}}) {
+	l.unsafeWritten(key)
+	{{- if .ValType.IsPtr }}
+	cpy := *value
+	l.unsafeSet(key, &cpy)
+	{{- else if .ValType.IsSlice }}
+	cpy := make({{.ValType.String}}, len(value))
+	copy(cpy, value)
+	l.unsafeSet(key, cpy)
+	{{- else }}
+	l.unsafeSet(key, value)
+	{{- end }}
+}
+
+func (l *{{.Name}}) unsafeClear(key {{.CacheKeyType}}) {
+	l.unsafeWritten(key)
+	{{- if .Cache}}
+	if l.cache != nil {
+		l.cache.Delete(key)
+	}
+	{{- else}}
+	delete(l.errCache, key)
+	delete(l.cache, key)
+	{{- end}}
+}
+
+// unsafeWritten stops batches that are already in flight from caching a stale result over a write to key
+func (l *{{.Name}}) unsafeWritten(key {{.CacheKeyType}}) {
+	for b := range l.inflight {
+		if b.written == nil {
+			b.written = map[{{.CacheKeyType}}]bool{}
+		}
+		b.written[key] = true
+	}
+}
+
+func (l *{{.Name}}) unsafeSetError(key {{.CacheKeyType}}, err error) {
+	{{- if .Cache}}
+	if l.cache == nil {
+		l.cache = dataloader.NewMapCache[{{.CacheKeyType}}, {{.ValType.String}}]()
+	}
+	dataloader.CacheSetError(l.cache, key, err)
+	{{- else}}
+	if l.errCache == nil {
+		l.errCache = map[{{.CacheKeyType}}]error{}
+	}
+	l.errCache[key] = err
+	{{- end}}
 }
 
 // keyIndex will return the location of the key in the batch, if its not found
 // it will add the key to the batch
-func (b *{{.Name|lcFirst}}Batch) keyIndex(l *{{.Name}}, key {{.KeyType}}) int {
-	for i, existingKey := range b.keys {
-		if key == existingKey {
-			return i
-		}
+func (b *{{.Name|lcFirst}}Batch) keyIndex(l *{{.Name}}, key {{.KeyType}}{{if .CacheKey}}, cacheKey {{.CacheKeyType}}{{end}}) int {
+	if i, ok := b.index[{{$ck}}]; ok {
+		return i
 	}
 
 	pos := len(b.keys)
 	b.keys = append(b.keys, key)
+	{{- if .CacheKey}}
+	b.cacheKeys = append(b.cacheKeys, cacheKey)
+	{{- end}}
+	b.index[{{$ck}}] = pos
 	if pos == 0 {
-		go b.startTimer(l)
+		b.startTimer(l)
 	}
 
 	if l.maxBatch != 0 && pos >= l.maxBatch-1 {
-		if !b.closing {
-			b.closing = true
-			l.batch = nil
-			go b.end(l)
-		}
+		b.dispatch(l)
 	}
 
 	return pos
 }
 
+// startTimer schedules the batch to be sent once wait has passed, or by the scheduler if there is one.
+// The timer is stopped if the batch is closed early.
 func (b *{{.Name|lcFirst}}Batch) startTimer(l *{{.Name}}) {
-	time.Sleep(l.wait)
+	b.start = time.Now()
+	if l.scheduler != nil {
+		l.scheduler.Schedule(func() {
+			l.mu.Lock()
+			b.dispatch(l)
+			l.mu.Unlock()
+		})
+		return
+	}
+
+	b.timer = time.AfterFunc(l.wait, func() {
+		b.timeout(l)
+	})
+}
+
+func (b *{{.Name|lcFirst}}Batch) timeout(l *{{.Name}}) {
 	l.mu.Lock()
 
-	// we must have hit a batch limit and are already finalizing this batch
+	// we must have hit a batch limit or been flushed and are already finalizing this batch
 	if b.closing {
 		l.mu.Unlock()
 		return
 	}
 
+	b.closing = true
 	l.batch = nil
 	l.mu.Unlock()
 
 	b.end(l)
 }
 
+// dispatch stops the batch collecting keys and sends it straight away, it must be called while holding the lock
+func (b *{{.Name|lcFirst}}Batch) dispatch(l *{{.Name}}) {
+	if b.closing {
+		return
+	}
+
+	b.closing = true
+	if b.timer != nil {
+		b.timer.Stop()
+	}
+	if l.batch == b {
+		l.batch = nil
+	}
+	go b.end(l)
+}
+
 func (b *{{.Name|lcFirst}}Batch) end(l *{{.Name}}) {
-	b.data, b.error = l.fetch(b.keys)
+	l.mu.Lock()
+	l.stats.Batches++
+	l.stats.Keys += len(b.keys)
+	l.mu.Unlock()
+
+	event := dataloader.BatchEvent{Loader: "{{.Name}}", Keys: len(b.keys), Wait: time.Since(b.start)}
+	{{- if .Context}}
+	b.ctx = l.hooks.BatchStart(b.ctx, event)
+	{{- else}}
+	ctx := l.hooks.BatchStart(context.Background(), event)
+	{{- end}}
+	start := time.Now()
+
+	panicErr := b.fetch(l)
+	duration := time.Since(start)
+	l.hooks.BatchEnd({{if .Context}}b.ctx{{else}}ctx{{end}}, event, duration, b.error)
+	l.logBatch(b.keys, duration)
+	l.mu.Lock()
+	b.cache(l)
+	l.mu.Unlock()
+	{{- if .Context}}
+	b.cancel()
+	{{- end}}
 	close(b.done)
+
+	if panicErr != nil && l.panicHandler != nil {
+		l.panicHandler(panicErr)
+	}
+}
+
+// cache stores the results of the batch{{if .Context}}, unless every waiter gave up on it{{end}}. Keys written since the
+// batch started keep what was written.
+func (b *{{.Name|lcFirst}}Batch) cache(l *{{.Name}}) {
+	delete(l.inflight, b)
+	if b.cleared{{if .Context}} || b.ctx.Err() != nil{{end}} {
+		return
+	}
+
+	for pos, key := range b.{{if .CacheKey}}cacheKeys{{else}}keys{{end}} {
+		if b.written[key] {
+			continue
+		}
+		data, err := b.result(pos)
+		if err == nil {
+			l.unsafeSet(key, data)
+		} else if dataloader.IsNotFound(err, l.notFound) || (l.cacheErrors != nil && l.cacheErrors(err)) {
+			l.unsafeSetError(key, err)
+		}
+	}
+}
+
+// result is the {{.ValType.Name}} and error fetched for the key at pos
+func (b *{{.Name|lcFirst}}Batch) result(pos int) ({{.ValType.String}}, error) {
+	var data {{.ValType.String}}
+	if pos < len(b.data) {
+		data = b.data[pos]
+	}
+
+	var err error
+	// its convenient to be able to return a single error for everything
+	if len(b.error) == 1 {
+		err = b.error[0]
+	} else if len(b.error) > 0 {
+		err = b.error[pos]
+	}
+	return data, err
+}
+
+// fetch calls the fetch func for the batch, any panic is recovered and returned to every waiter
+func (b *{{.Name|lcFirst}}Batch) fetch(l *{{.Name}}) (panicErr *dataloader.PanicError) {
+	defer func() {
+		if r := recover(); r != nil {
+			panicErr = dataloader.NewPanicError("{{.Name}}", r)
+			b.data = nil
+			b.error = []error{panicErr}
+		}
+	}()
+{{if .MapFetch}}
+	data, err := l.fetch({{if .Context}}b.ctx, {{end}}b.keys)
+	b.fromMap(l, data, err)
+{{- else}}
+	{{- if .Result}}
+	b.data, b.error = dataloader.SplitResults(l.fetch({{if .Context}}b.ctx, {{end}}b.keys))
+	{{- else}}
+	b.data, b.error = l.fetch({{if .Context}}b.ctx, {{end}}b.keys)
+	{{- end}}
+	if err := dataloader.CheckBatchLength("{{.Name}}", len(b.keys), len(b.data), b.error); err != nil {
+		b.data = nil
+		b.error = []error{err}
+	}
+	{{- end}}
+	return nil
 }
+{{- if .MapFetch}}
+
+// fromMap lines the values returned by fetch up with the keys in the batch
+func (b *{{.Name|lcFirst}}Batch) fromMap(l *{{.Name}}, data map[{{.CacheKeyType}}]{{.ValType.String}}, err error) {
+	if err != nil {
+		b.error = []error{err}
+		return
+	}
+
+	b.data = make([]{{.ValType.String}}, len(b.keys))
+	for i, key := range b.{{if .CacheKey}}cacheKeys{{else}}keys{{end}} {
+		value, ok := data[key]
+		if !ok {
+			if b.error == nil {
+				b.error = make([]error, len(b.keys))
+			}
+			b.error[i] = l.notFound
+		}
+		b.data[i] = value
+	}
+}
+{{- end}}
+{{- if .Context}}
+
+// abandon is called when the context of a waiter is done. Once every waiter has given up a batch that is still
+// collecting keys is dropped without being fetched, and a batch that is already being fetched has its context cancelled.
+func (b *{{.Name|lcFirst}}Batch) abandon(l *{{.Name}}) {
+	b.waiters--
+	if b.waiters > 0 {
+		return
+	}
+
+	if l.batch == b {
+		b.closing = true
+		if b.timer != nil {
+			b.timer.Stop()
+		}
+		l.batch = nil
+		delete(l.inflight, b)
+	}
+	b.cancel()
+}
+{{- end}}
+{{- if .Middleware}}
+{{template "middleware" .}}
+{{- end}}
 `))
+
+var genericTpl = template.Must(template.Must(template.New("generic").Funcs(funcs).Parse(middlewareTpl)).Parse(`
+// Code generated by github.com/vektah/dataloaden, DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+    {{- if .Middleware}}
+    "context"
+    "net/http"
+    {{- end}}
+
+    "github.com/vektah/dataloaden/pkg/dataloader"
+
+    {{range .Imports -}}
+    {{.Alias}} "{{.Path}}"
+    {{end -}}
+)
+
+// {{.Name}}Config captures the config to create a new {{.Name}}
+type {{.Name}}Config = dataloader.Config[{{.KeyType.String}}, {{.ValType.String}}]
+
+// {{.Name}} batches and caches requests
+type {{.Name}} = dataloader.Loader[{{.KeyType.String}}, {{.ValType.String}}]
+
+// New{{.Name}} creates a new {{.Name}} given a fetch, wait, and maxBatch
+func New{{.Name}}(config {{.Name}}Config) *{{.Name}} {
+	if config.Name == "" {
+		config.Name = "{{.Name}}"
+	}
+	return dataloader.New(config)
+}
+{{- if .Middleware}}
+{{template "middleware" .}}
+{{- end}}
+`))
+
+// middlewareTpl stores a loader in the context of each request
+const middlewareTpl = `
+{{- define "middleware"}}
+// {{.Name|lcFirst}}CtxKey is the context key a {{.Name}} is stored under
+type {{.Name|lcFirst}}CtxKey struct{}
+
+// With{{.Name}} returns a copy of ctx carrying a new {{.Name}} created from config
+func With{{.Name}}(ctx context.Context, config {{.Name}}Config) context.Context {
+	return context.WithValue(ctx, {{.Name|lcFirst}}CtxKey{}, New{{.Name}}(config))
+}
+
+// {{.Name}}From returns the {{.Name}} stored in ctx by With{{.Name}}, or nil if there isn't one
+func {{.Name}}From(ctx context.Context) *{{.Name}} {
+	l, _ := ctx.Value({{.Name|lcFirst}}CtxKey{}).(*{{.Name}})
+	return l
+}
+
+// {{.Name}}Middleware creates a new {{.Name}} for every request and stores it in the request context.
+// config is called for each request, so the loader can be configured per request.
+func {{.Name}}Middleware(config func(r *http.Request) {{.Name}}Config) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(With{{.Name}}(r.Context(), config(r))))
+		})
+	}
+}
+{{- end}}`
@@ -0,0 +1,5 @@
+package dataloader
+
+type User struct {
+	Name string
+}
@@ -3,3 +3,9 @@ package mismatched
 type Foo struct {
 	Name string
 }
+
+type Page[T any] struct {
+	Items []T
+}
+
+type unexported struct{}
@@ -0,0 +1,382 @@
+package generator
+
+import (
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// qualifiedRe matches named types qualified by their full import path, eg github.com/my/package.User or time.Time
+var qualifiedRe = regexp.MustCompile(`([\w\-.~]+(?:/[\w\-.~]+)*)\.([A-Za-z_]\w*)`)
+
+// importPlaceholder replaces import paths in type expressions, so they can be parsed as go
+const importPlaceholder = "dataloaden_import_"
+
+// goType is a go type expression given to the generator, where named types are qualified by their full import path
+// eg map[string][]*github.com/my/package.User
+type goType struct {
+	// expr is the parsed expression, with each import path replaced by a placeholder identifier
+	expr ast.Expr
+
+	// imports maps the placeholders in expr back to the import paths they replaced
+	imports map[string]string
+
+	// typ and str are set once the type has been resolved
+	typ types.Type
+	str string
+}
+
+// parseType parses a type expression without looking up any of the packages it refers to
+func parseType(str string) (*goType, error) {
+	t := &goType{imports: map[string]string{}}
+	placeholders := map[string]string{}
+
+	src := qualifiedRe.ReplaceAllStringFunc(str, func(match string) string {
+		parts := qualifiedRe.FindStringSubmatch(match)
+		placeholder, ok := placeholders[parts[1]]
+		if !ok {
+			placeholder = fmt.Sprintf("%s%d", importPlaceholder, len(placeholders))
+			placeholders[parts[1]] = placeholder
+			t.imports[placeholder] = parts[1]
+		}
+		return placeholder + "." + parts[2]
+	})
+
+	expr, err := parser.ParseExpr(src)
+	if err != nil {
+		return nil, fmt.Errorf("must be in the form []*github.com/import/path.Name")
+	}
+	if err := checkTypeExpr(expr); err != nil {
+		return nil, err
+	}
+	t.expr = expr
+
+	return t, nil
+}
+
+// checkTypeExpr makes sure expr only uses the kinds of types a loader can be generated for
+func checkTypeExpr(expr ast.Expr) error {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		return nil
+	case *ast.SelectorExpr:
+		// the only selectors in a type are the qualified names whose import paths were replaced by placeholders
+		if x, ok := e.X.(*ast.Ident); !ok || !strings.HasPrefix(x.Name, importPlaceholder) {
+			return fmt.Errorf("must be in the form []*github.com/import/path.Name")
+		}
+		return nil
+	case *ast.ParenExpr:
+		return checkTypeExpr(e.X)
+	case *ast.StarExpr:
+		return checkTypeExpr(e.X)
+	case *ast.ArrayType:
+		if e.Len != nil {
+			if lit, ok := e.Len.(*ast.BasicLit); !ok || lit.Kind != token.INT {
+				return fmt.Errorf("array lengths must be integer literals")
+			}
+		}
+		return checkTypeExpr(e.Elt)
+	case *ast.MapType:
+		if err := checkTypeExpr(e.Key); err != nil {
+			return err
+		}
+		return checkTypeExpr(e.Value)
+	case *ast.IndexExpr:
+		if err := checkTypeExpr(e.X); err != nil {
+			return err
+		}
+		return checkTypeExpr(e.Index)
+	case *ast.IndexListExpr:
+		if err := checkTypeExpr(e.X); err != nil {
+			return err
+		}
+		for _, index := range e.Indices {
+			if err := checkTypeExpr(index); err != nil {
+				return err
+			}
+		}
+		return nil
+	case *ast.StructType:
+		for _, field := range e.Fields.List {
+			if len(field.Names) == 0 {
+				return fmt.Errorf("embedded fields are not supported")
+			}
+			if err := checkTypeExpr(field.Type); err != nil {
+				return err
+			}
+		}
+		return nil
+	case *ast.InterfaceType:
+		if len(e.Methods.List) > 0 {
+			return fmt.Errorf("only empty interfaces are supported")
+		}
+		return nil
+	case *ast.ChanType:
+		return fmt.Errorf("channels are not supported")
+	default:
+		return fmt.Errorf("only named, pointer, slice, array, map, struct, interface and generic types are supported")
+	}
+}
+
+// importPaths lists every package the type refers to
+func (t *goType) importPaths() []string {
+	var paths []string
+	for _, path := range t.imports {
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+// resolve looks up the type. local is the package the loader is generated into and may be nil, unqualified names
+// are looked up there. pkgs are the loaded packages by import path.
+func (t *goType) resolve(local *types.Package, pkgs map[string]*packages.Package, imports *fileImports) error {
+	typ, err := t.resolveExpr(t.expr, local, pkgs)
+	if err != nil {
+		return err
+	}
+
+	t.typ = typ
+	t.str = types.TypeString(typ, imports.qualifier)
+	return nil
+}
+
+func (t *goType) resolveExpr(expr ast.Expr, local *types.Package, pkgs map[string]*packages.Package) (types.Type, error) {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		if obj, ok := types.Universe.Lookup(e.Name).(*types.TypeName); ok {
+			return obj.Type(), nil
+		}
+		if local != nil {
+			if obj, ok := local.Scope().Lookup(e.Name).(*types.TypeName); ok {
+				return obj.Type(), nil
+			}
+		}
+		return nil, fmt.Errorf("unknown type %s", e.Name)
+
+	case *ast.SelectorExpr:
+		path := t.imports[e.X.(*ast.Ident).Name]
+		p := pkgs[path]
+		if p == nil || p.Name == "" || p.Types == nil {
+			return nil, fmt.Errorf("unable to find package %s", path)
+		}
+		obj, ok := p.Types.Scope().Lookup(e.Sel.Name).(*types.TypeName)
+		if !ok {
+			return nil, fmt.Errorf("unable to find type %s in %s", e.Sel.Name, path)
+		}
+		if !obj.Exported() && (local == nil || local.Path() != path) {
+			return nil, fmt.Errorf("%s.%s is not exported", path, e.Sel.Name)
+		}
+		return obj.Type(), nil
+
+	case *ast.ParenExpr:
+		return t.resolveExpr(e.X, local, pkgs)
+
+	case *ast.StarExpr:
+		elem, err := t.resolveExpr(e.X, local, pkgs)
+		if err != nil {
+			return nil, err
+		}
+		return types.NewPointer(elem), nil
+
+	case *ast.ArrayType:
+		elem, err := t.resolveExpr(e.Elt, local, pkgs)
+		if err != nil {
+			return nil, err
+		}
+		if e.Len == nil {
+			return types.NewSlice(elem), nil
+		}
+		n, ok := constant.Int64Val(constant.MakeFromLiteral(e.Len.(*ast.BasicLit).Value, token.INT, 0))
+		if !ok {
+			return nil, fmt.Errorf("invalid array length %s", e.Len.(*ast.BasicLit).Value)
+		}
+		return types.NewArray(elem, n), nil
+
+	case *ast.MapType:
+		key, err := t.resolveExpr(e.Key, local, pkgs)
+		if err != nil {
+			return nil, err
+		}
+		value, err := t.resolveExpr(e.Value, local, pkgs)
+		if err != nil {
+			return nil, err
+		}
+		return types.NewMap(key, value), nil
+
+	case *ast.StructType:
+		var fields []*types.Var
+		var tags []string
+		for _, field := range e.Fields.List {
+			typ, err := t.resolveExpr(field.Type, local, pkgs)
+			if err != nil {
+				return nil, err
+			}
+			tag := ""
+			if field.Tag != nil {
+				tag, _ = strconv.Unquote(field.Tag.Value)
+			}
+			for _, name := range field.Names {
+				fields = append(fields, types.NewField(token.NoPos, local, name.Name, typ, false))
+				tags = append(tags, tag)
+			}
+		}
+		return types.NewStruct(fields, tags), nil
+
+	case *ast.InterfaceType:
+		return types.NewInterfaceType(nil, nil).Complete(), nil
+
+	case *ast.IndexExpr:
+		return t.instantiate(e.X, []ast.Expr{e.Index}, local, pkgs)
+
+	case *ast.IndexListExpr:
+		return t.instantiate(e.X, e.Indices, local, pkgs)
+	}
+
+	return nil, fmt.Errorf("unsupported type expression")
+}
+
+func (t *goType) instantiate(generic ast.Expr, args []ast.Expr, local *types.Package, pkgs map[string]*packages.Package) (types.Type, error) {
+	orig, err := t.resolveExpr(generic, local, pkgs)
+	if err != nil {
+		return nil, err
+	}
+
+	targs := make([]types.Type, len(args))
+	for i, arg := range args {
+		targs[i], err = t.resolveExpr(arg, local, pkgs)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	typ, err := types.Instantiate(nil, orig, targs, true)
+	if err != nil {
+		return nil, fmt.Errorf("instantiating %s: %s", orig.String(), err.Error())
+	}
+	return typ, nil
+}
+
+func (t *goType) String() string {
+	return t.str
+}
+
+// Name is the name of the type with any pointers, slices, arrays and maps stripped off, used to name things in
+// the generated code
+func (t *goType) Name() string {
+	typ := t.typ
+	for {
+		switch u := typ.(type) {
+		case *types.Pointer:
+			typ = u.Elem()
+		case *types.Slice:
+			typ = u.Elem()
+		case *types.Array:
+			typ = u.Elem()
+		case *types.Map:
+			typ = u.Elem()
+		case *types.Named:
+			return u.Obj().Name()
+		case *types.Alias:
+			return u.Obj().Name()
+		case *types.Basic:
+			return u.Name()
+		default:
+			return "Value"
+		}
+	}
+}
+
+func (t *goType) IsPtr() bool {
+	_, ok := t.typ.(*types.Pointer)
+	return ok
+}
+
+func (t *goType) IsSlice() bool {
+	_, ok := t.typ.(*types.Slice)
+	return ok
+}
+
+type importSpec struct {
+	Alias string
+	Path  string
+}
+
+// templateImports are the packages the templates import themselves, by name. Other packages with these names have
+// to be aliased.
+var templateImports = map[string]string{
+	"context":    "context",
+	"dataloader": "github.com/vektah/dataloaden/pkg/dataloader",
+	"http":       "net/http",
+	"slog":       "log/slog",
+	"sync":       "sync",
+	"time":       "time",
+}
+
+// templatePaths lists the import paths the template for opts imports itself
+func templatePaths(opts Options) []string {
+	paths := []string{templateImports["dataloader"]}
+	if !opts.Generic {
+		paths = append(paths, "context", "log/slog", "sync", "time")
+	}
+	if opts.Middleware {
+		paths = append(paths, "net/http")
+		if opts.Generic {
+			paths = append(paths, "context")
+		}
+	}
+	return paths
+}
+
+// fileImports names the packages imported by a generated file, aliasing any whose names collide
+type fileImports struct {
+	// local is the import path of the package being generated into, it doesn't need to be imported
+	local string
+
+	// imported are the paths the template already imports, they don't need to be imported again
+	imported map[string]bool
+
+	names   map[string]string
+	taken   map[string]bool
+	Imports []importSpec
+}
+
+func newFileImports(local string, imported []string) *fileImports {
+	f := &fileImports{local: local, imported: map[string]bool{}, names: map[string]string{}, taken: map[string]bool{}}
+	for _, path := range imported {
+		f.imported[path] = true
+	}
+	return f
+}
+
+func (f *fileImports) qualifier(p *types.Package) string {
+	if p.Path() == f.local {
+		return ""
+	}
+	if name, ok := f.names[p.Path()]; ok {
+		return name
+	}
+
+	name, alias := p.Name(), ""
+	if f.imported[p.Path()] {
+		f.names[p.Path()] = name
+		f.taken[name] = true
+		return name
+	}
+	for i := 2; f.taken[name] || (templateImports[name] != "" && templateImports[name] != p.Path()); i++ {
+		name = fmt.Sprintf("%s%d", p.Name(), i)
+		alias = name
+	}
+
+	f.names[p.Path()] = name
+	f.taken[name] = true
+	f.Imports = append(f.Imports, importSpec{Alias: alias, Path: p.Path()})
+	return name
+}
@@ -0,0 +1,144 @@
+// Package instrument adapts dataloader.Hooks to metrics and tracing. It only depends on small interfaces, which
+// prometheus collectors satisfy directly and which are a few lines to implement over an OpenTelemetry tracer.
+package instrument
+
+import (
+	"context"
+
+	"github.com/vektah/dataloaden/pkg/dataloader"
+)
+
+// Counter is satisfied by prometheus.Counter
+type Counter interface {
+	Inc()
+	Add(float64)
+}
+
+// Observer is satisfied by prometheus.Observer, ie histograms and summaries
+type Observer interface {
+	Observe(float64)
+}
+
+// Metrics picks the collector for each loader, eg with a prometheus CounterVec:
+//
+//	Loads: func(loader string) instrument.Counter { return loads.WithLabelValues(loader) },
+//
+// Any of them can be nil.
+type Metrics struct {
+	// Loads counts every key loaded, including those served from the cache
+	Loads func(loader string) Counter
+
+	// Hits counts the keys served from the cache
+	Hits func(loader string) Counter
+
+	// Batches counts the batches fetched
+	Batches func(loader string) Counter
+
+	// Errors counts the keys that failed to fetch
+	Errors func(loader string) Counter
+
+	// BatchSize observes how many keys are in each batch
+	BatchSize func(loader string) Observer
+
+	// BatchWait observes how long each batch spent collecting keys, in seconds
+	BatchWait func(loader string) Observer
+
+	// FetchDuration observes how long each fetch took, in seconds
+	FetchDuration func(loader string) Observer
+}
+
+// Hooks records the metrics as loaders work
+func (m Metrics) Hooks() *dataloader.Hooks {
+	return &dataloader.Hooks{
+		OnLoad: func(loader string) {
+			if m.Loads != nil {
+				m.Loads(loader).Inc()
+			}
+		},
+		OnCacheHit: func(loader string) {
+			if m.Hits != nil {
+				m.Hits(loader).Inc()
+			}
+		},
+		OnBatchEnd: func(ctx context.Context, batch dataloader.BatchEvent) {
+			if m.Batches != nil {
+				m.Batches(batch.Loader).Inc()
+			}
+			if m.Errors != nil && batch.Errors > 0 {
+				m.Errors(batch.Loader).Add(float64(batch.Errors))
+			}
+			if m.BatchSize != nil {
+				m.BatchSize(batch.Loader).Observe(float64(batch.Keys))
+			}
+			if m.BatchWait != nil {
+				m.BatchWait(batch.Loader).Observe(batch.Wait.Seconds())
+			}
+			if m.FetchDuration != nil {
+				m.FetchDuration(batch.Loader).Observe(batch.Duration.Seconds())
+			}
+		},
+	}
+}
+
+// Tracer starts spans, an OpenTelemetry trace.Tracer can be adapted to it in a few lines
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is the part of a span the hooks need
+type Span interface {
+	SetAttribute(key string, value int64)
+	End()
+}
+
+type spanKey struct{}
+
+// Trace starts a span named after the loader for every batch fetched. Loaders that take a context pass the span's
+// context to fetch, so anything fetch does is traced as a child of the batch.
+func Trace(tracer Tracer) *dataloader.Hooks {
+	return &dataloader.Hooks{
+		OnBatchStart: func(ctx context.Context, batch dataloader.BatchEvent) context.Context {
+			ctx, span := tracer.Start(ctx, "dataloader "+batch.Loader)
+			span.SetAttribute("dataloader.keys", int64(batch.Keys))
+			span.SetAttribute("dataloader.wait_us", batch.Wait.Microseconds())
+			return context.WithValue(ctx, spanKey{}, span)
+		},
+		OnBatchEnd: func(ctx context.Context, batch dataloader.BatchEvent) {
+			span, ok := ctx.Value(spanKey{}).(Span)
+			if !ok {
+				return
+			}
+			span.SetAttribute("dataloader.errors", int64(batch.Errors))
+			span.End()
+		},
+	}
+}
+
+// Combine calls every hook in order. The context returned by each OnBatchStart is passed to the next.
+func Combine(hooks ...*dataloader.Hooks) *dataloader.Hooks {
+	return &dataloader.Hooks{
+		OnLoad: func(loader string) {
+			for _, h := range hooks {
+				h.Load(loader)
+			}
+		},
+		OnCacheHit: func(loader string) {
+			for _, h := range hooks {
+				h.CacheHit(loader)
+			}
+		},
+		OnBatchStart: func(ctx context.Context, batch dataloader.BatchEvent) context.Context {
+			for _, h := range hooks {
+				ctx = h.BatchStart(ctx, batch)
+			}
+			return ctx
+		},
+		OnBatchEnd: func(ctx context.Context, batch dataloader.BatchEvent) {
+			for _, h := range hooks {
+				if h != nil && h.OnBatchEnd != nil {
+					h.OnBatchEnd(ctx, batch)
+				}
+			}
+		},
+	}
+}
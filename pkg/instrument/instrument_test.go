@@ -0,0 +1,125 @@
+package instrument
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vektah/dataloaden/pkg/dataloader"
+)
+
+type recorder struct {
+	values map[string][]float64
+	mu     sync.Mutex
+}
+
+func (r *recorder) record(name string, value float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.values[name] = append(r.values[name], value)
+}
+
+func (r *recorder) total(name string) float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var total float64
+	for _, v := range r.values[name] {
+		total += v
+	}
+	return total
+}
+
+type collector struct {
+	name string
+	r    *recorder
+}
+
+func (c collector) Inc()                  { c.r.record(c.name, 1) }
+func (c collector) Add(v float64)         { c.r.record(c.name, v) }
+func (c collector) Observe(value float64) { c.r.record(c.name, value) }
+
+func TestMetrics(t *testing.T) {
+	r := &recorder{values: map[string][]float64{}}
+	counter := func(metric string) func(loader string) Counter {
+		return func(loader string) Counter { return collector{name: loader + " " + metric, r: r} }
+	}
+	observer := func(metric string) func(loader string) Observer {
+		return func(loader string) Observer { return collector{name: loader + " " + metric, r: r} }
+	}
+
+	dl := dataloader.New(dataloader.Config[int, string]{
+		Name: "IntLoader",
+		Wait: time.Millisecond,
+		Hooks: Metrics{
+			Loads:         counter("loads"),
+			Hits:          counter("hits"),
+			Batches:       counter("batches"),
+			Errors:        counter("errors"),
+			BatchSize:     observer("size"),
+			FetchDuration: observer("duration"),
+		}.Hooks(),
+		Fetch: func(keys []int) ([]string, []error) {
+			return make([]string, len(keys)), []error{nil, errors.New("failed"), nil}
+		},
+	})
+
+	dl.LoadAll([]int{1, 2, 3})
+	dl.Load(1)
+
+	require.Equal(t, 4.0, r.total("IntLoader loads"))
+	require.Equal(t, 1.0, r.total("IntLoader hits"))
+	require.Equal(t, 1.0, r.total("IntLoader batches"))
+	require.Equal(t, 1.0, r.total("IntLoader errors"))
+	require.Equal(t, []float64{3}, r.values["IntLoader size"])
+	require.Len(t, r.values["IntLoader duration"], 1)
+}
+
+type span struct {
+	name  string
+	attrs map[string]int64
+	ended bool
+}
+
+func (s *span) SetAttribute(key string, value int64) { s.attrs[key] = value }
+func (s *span) End()                                 { s.ended = true }
+
+type tracer struct {
+	spans []*span
+}
+
+func (t *tracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	s := &span{name: name, attrs: map[string]int64{}}
+	t.spans = append(t.spans, s)
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+func TestTrace(t *testing.T) {
+	tr := &tracer{}
+	var fetchSpan *span
+	var loads int
+
+	dl := dataloader.New(dataloader.Config[int, string]{
+		Name: "IntLoader",
+		Wait: time.Millisecond,
+		Hooks: Combine(Trace(tr), &dataloader.Hooks{
+			OnLoad: func(loader string) { loads++ },
+		}),
+		FetchCtx: func(ctx context.Context, keys []int) ([]string, []error) {
+			fetchSpan, _ = ctx.Value(spanKey{}).(*span)
+			return nil, []error{errors.New("failed")}
+		},
+	})
+
+	dl.LoadAll([]int{1, 2})
+
+	require.Equal(t, 2, loads)
+	require.Len(t, tr.spans, 1)
+	require.Equal(t, "dataloader IntLoader", tr.spans[0].name)
+	require.Equal(t, tr.spans[0], fetchSpan, "fetch is given the span context")
+	require.Equal(t, int64(2), tr.spans[0].attrs["dataloader.keys"])
+	require.Equal(t, int64(2), tr.spans[0].attrs["dataloader.errors"], "a single error fails every key")
+	require.True(t, tr.spans[0].ended)
+}